@@ -0,0 +1,178 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ModerationAction struct {
+	Reason string `json:"reason"`
+}
+
+// Admin requests carry the shared admin token and the id of the acting moderator
+func adminAuth(ctx *fiber.Ctx) error {
+	if config.adminToken == "" || ctx.Get("Authorization") != "Bearer "+config.adminToken {
+		return fiber.NewError(401, "Invalid admin token")
+	}
+	actorId, err := strconv.ParseInt(ctx.Get("X-Admin-Id"), 10, 64)
+	if err != nil {
+		return fiber.NewError(401, "Missing admin id")
+	}
+	ctx.Locals("admin_id", actorId)
+	return ctx.Next()
+}
+
+func adminId(ctx *fiber.Ctx) int64 {
+	return ctx.Locals("admin_id").(int64)
+}
+
+func registerAdminRoutes(admin fiber.Router) {
+	admin.Get("/audit", listAudit)
+	admin.Get("/audit/verify", verifyAudit)
+	registerReplayRoutes(admin)
+	admin.Get("/held", listHeldVideos)
+	admin.Get("/storage/top", getTopStorageUsers)
+	registerBlocklistRoutes(admin)
+	registerKillSwitchRoutes(admin)
+	registerUploadPolicyRoutes(admin)
+	admin.Get("/reports", listReports)
+	admin.Post("/report/:report_id/review", reviewReport)
+	admin.Post("/video/:video_id/release", releaseHeldVideo)
+	admin.Post("/video/:video_id/reprocess", reprocessVideo)
+	admin.Get("/reprocess/:job_id", getReprocessJob)
+	admin.Post("/video/:video_id/takedown", func(ctx *fiber.Ctx) error {
+		return setTakenDown(ctx, true)
+	})
+	admin.Post("/video/:video_id/restore", func(ctx *fiber.Ctx) error {
+		return setTakenDown(ctx, false)
+	})
+	admin.Post("/video/:video_id/age_restriction", adminSetAgeRestriction)
+	admin.Post("/video/:video_id/content_warnings", adminSetContentWarnings)
+	admin.Post("/video/:video_id/regions", adminSetRegions)
+	admin.Post("/user/:user_id/strike", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		var action ModerationAction
+		err = ctx.BodyParser(&action)
+		if err != nil {
+			return err
+		}
+
+		_, err = usersCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", userId}}, bson.D{{"$inc", bson.D{{"strikes", 1}}}})
+		if err != nil {
+			return err
+		}
+		return recordAudit(adminId(ctx), "strike", "user", ctx.Params("user_id"), action.Reason)
+	})
+	admin.Post("/user/:user_id/verify", func(ctx *fiber.Ctx) error {
+		return setVerified(ctx, true)
+	})
+	admin.Post("/user/:user_id/unverify", func(ctx *fiber.Ctx) error {
+		return setVerified(ctx, false)
+	})
+	admin.Post("/tag/:tag/ban", func(ctx *fiber.Ctx) error {
+		var action ModerationAction
+		err := ctx.BodyParser(&action)
+		if err != nil {
+			return err
+		}
+
+		tag := ctx.Params("tag")
+		_, err = bannedTagsCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", tag}}, bson.D{{"$set", bson.D{{"_id", tag}}}}, options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+		return recordAudit(adminId(ctx), "tag_ban", "tag", tag, action.Reason)
+	})
+	admin.Post("/tag/:tag/unban", func(ctx *fiber.Ctx) error {
+		var action ModerationAction
+		err := ctx.BodyParser(&action)
+		if err != nil {
+			return err
+		}
+
+		tag := ctx.Params("tag")
+		_, err = bannedTagsCollection.DeleteOne(ctx.UserContext(), bson.D{{"_id", tag}})
+		if err != nil {
+			return err
+		}
+		return recordAudit(adminId(ctx), "tag_unban", "tag", tag, action.Reason)
+	})
+}
+
+func setTakenDown(ctx *fiber.Ctx, takenDown bool) error {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var action ModerationAction
+	err = ctx.BodyParser(&action)
+	if err != nil {
+		return err
+	}
+
+	if takenDown {
+		return takeDownVideo(ctx, videoId, action.Reason)
+	}
+	result, err := videosCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", videoId}}, bson.D{{"$set", bson.D{{"taken_down", false}}}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fiber.NewError(404, "Video not found")
+	}
+	syncSearchIndex(videoId)
+	return recordAudit(adminId(ctx), "restore", "video", ctx.Params("video_id"), action.Reason)
+}
+
+// Takes the video down for the admin making the request, resolving its open reports
+func takeDownVideo(ctx *fiber.Ctx, videoId int64, reason string) error {
+	result, err := videosCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", videoId}}, bson.D{{"$set", bson.D{{"taken_down", true}}}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fiber.NewError(404, "Video not found")
+	}
+	syncSearchIndex(videoId)
+	err = resolveReports(videoId)
+	if err != nil {
+		return err
+	}
+	return recordAudit(adminId(ctx), "takedown", "video", strconv.FormatInt(videoId, 10), reason)
+}
+
+func withoutBannedTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return tags, nil
+	}
+	banned, err := bannedTagsCollection.Distinct(mctx, "_id", bson.D{{"_id", bson.D{{"$in", tags}}}})
+	if err != nil {
+		return nil, err
+	}
+	bannedSet := make(map[string]bool)
+	for _, tag := range banned {
+		bannedSet[tag.(string)] = true
+	}
+
+	allowed := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if !bannedSet[tag] {
+			allowed = append(allowed, tag)
+		}
+	}
+	return allowed, nil
+}
+
+// Internal requests come from other backend services, such as the transcoding pipeline
+func internalAuth(ctx *fiber.Ctx) error {
+	if config.internalToken == "" || ctx.Get("Authorization") != "Bearer "+config.internalToken {
+		return fiber.NewError(401, "Invalid internal token")
+	}
+	return ctx.Next()
+}
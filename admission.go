@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Lower values are more important and are the last to be shed
+const (
+	priorityWatch = iota
+	priorityInteraction
+	priorityUpload
+	priorityAnalytics
+	priorityClasses
+)
+
+const (
+	admissionProbeInterval = time.Second
+	admissionPollInterval  = 50 * time.Millisecond
+)
+
+var priorityPrefixes = []struct {
+	prefix   string
+	priority int
+}{
+	{"/watch/", priorityWatch},
+	{"/progress/", priorityWatch},
+	{"/play/", priorityWatch},
+	{"/upload", priorityUpload},
+	{"/analytics/", priorityAnalytics},
+	{"/search", priorityAnalytics},
+	{"/internal/export/", priorityAnalytics},
+}
+
+// Mongo latency from the last probe, in nanoseconds
+var mongoLatency int64
+
+func requestPriority(path string) int {
+	for _, class := range priorityPrefixes {
+		if strings.HasPrefix(path, class.prefix) {
+			return class.priority
+		}
+	}
+	return priorityInteraction
+}
+
+// How many priority classes are admitted, one more class is shed every time the latency doubles past the threshold
+func admittedClasses() int {
+	latency := time.Duration(atomic.LoadInt64(&mongoLatency))
+	admitted := priorityClasses
+	for limit := config.admissionLatency; latency > limit && admitted > 1; limit *= 2 {
+		admitted--
+	}
+	return admitted
+}
+
+func startAdmissionControl() {
+	if config.admissionLatency == 0 {
+		return
+	}
+	every(admissionProbeInterval, func() {
+		atomic.StoreInt64(&mongoLatency, int64(probeMongo()))
+	})
+}
+
+// A failed ping counts as the slowest latency that still sheds everything that can be shed
+func probeMongo() time.Duration {
+	timeout := config.admissionLatency << (priorityClasses - 1)
+	pingCtx, cancel := context.WithTimeout(mctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := client.Ping(pingCtx, nil)
+	if err != nil {
+		log.Print(err)
+		return timeout
+	}
+	return time.Since(start)
+}
+
+// Queues shed requests for up to admission_queue_timeout in case latency recovers before rejecting them
+func admit(ctx *fiber.Ctx) error {
+	if config.admissionLatency == 0 {
+		return ctx.Next()
+	}
+	priority := requestPriority(ctx.Path())
+	deadline := time.Now().Add(config.admissionQueueTimeout)
+	for priority >= admittedClasses() {
+		if time.Now().After(deadline) {
+			ctx.Set("Retry-After", strconv.Itoa(int(admissionProbeInterval.Seconds())))
+			return fiber.NewError(503, "Server is under load, try again later")
+		}
+		time.Sleep(admissionPollInterval)
+	}
+	return ctx.Next()
+}
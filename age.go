@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type AgeRestrictionUpdate struct {
+	AgeRestricted bool   `json:"age_restricted"`
+	Reason        string `json:"reason"`
+}
+
+// Users whose age is unknown are treated as underage
+func userAge(user User) int64 {
+	if user.VerifiedAge > 0 {
+		return user.VerifiedAge
+	}
+	if user.Birthdate == nil {
+		return 0
+	}
+	now := time.Now()
+	age := int64(now.Year() - user.Birthdate.Year())
+	birthdate := user.Birthdate
+	if now.Month() < birthdate.Month() || (now.Month() == birthdate.Month() && now.Day() < birthdate.Day()) {
+		age--
+	}
+	return age
+}
+
+func canViewAgeRestricted(user User) bool {
+	return userAge(user) >= config.minimumAge
+}
+
+func updateAgeRestriction(videoId int64, ageRestricted bool) error {
+	_, err := videosCollection.UpdateOne(mctx, bson.D{{"_id", videoId}}, bson.D{{"$set", bson.D{{"age_restricted", ageRestricted}}}})
+	return err
+}
+
+// Creators can restrict their own videos
+func setAgeRestriction(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var update AgeRestrictionUpdate
+	err = ctx.BodyParser(&update)
+	if err != nil {
+		return err
+	}
+
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err != nil {
+		return err
+	}
+	if video.CreatorId != userId {
+		return fiber.NewError(403, "Only the creator can change this video")
+	}
+
+	return updateAgeRestriction(videoId, update.AgeRestricted)
+}
+
+// Moderators can restrict any video
+func adminSetAgeRestriction(ctx *fiber.Ctx) error {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var update AgeRestrictionUpdate
+	err = ctx.BodyParser(&update)
+	if err != nil {
+		return err
+	}
+
+	err = updateAgeRestriction(videoId, update.AgeRestricted)
+	if err != nil {
+		return err
+	}
+
+	action := "age_unrestrict"
+	if update.AgeRestricted {
+		action = "age_restrict"
+	}
+	return recordAudit(adminId(ctx), action, "video", ctx.Params("video_id"), update.Reason)
+}
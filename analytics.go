@@ -0,0 +1,191 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type EpisodeAnalytics struct {
+	VideoId int64 `json:"video_id"`
+	Watches int64 `json:"watches"`
+	Viewers int64 `json:"viewers"`
+	// Viewers of the previous episode that went on to watch this one
+	Retained int64   `json:"retained"`
+	DropOff  float64 `json:"drop_off"`
+}
+
+type SeriesAnalytics struct {
+	Series         string             `json:"series"`
+	Watches        int64              `json:"watches"`
+	CompletionRate float64            `json:"completion_rate"`
+	Episodes       []EpisodeAnalytics `json:"episodes"`
+}
+
+// Loads the :video_id video for its creator's analytics, returning ok=false with the error to respond with
+// when the :user_id user didn't make it. The :user_id route takes their token.
+func getOwnedVideo(ctx *fiber.Ctx) (Video, bool, error) {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return Video{}, false, err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return Video{}, false, err
+	}
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err == mongo.ErrNoDocuments {
+		return Video{}, false, fiber.NewError(404, "Video not found")
+	}
+	if err != nil {
+		return Video{}, false, err
+	}
+	if video.CreatorId != userId {
+		return Video{}, false, fiber.NewError(403, "Only the creator can see this video's analytics")
+	}
+	return video, true, nil
+}
+
+// Only for the creator, the :user_id route takes their token
+func getSeriesAnalytics(ctx *fiber.Ctx) error {
+	creatorId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	series := ctx.Params("series_id")
+
+	videos, err := seriesEpisodes(creatorId, series)
+	if err != nil {
+		return err
+	}
+	analytics := SeriesAnalytics{Series: series, Episodes: make([]EpisodeAnalytics, len(videos))}
+	if len(videos) == 0 {
+		return ctx.JSON(analytics)
+	}
+	videoIds := make([]int64, len(videos))
+	episodeIndex := make(map[int64]int)
+	for i, video := range videos {
+		videoIds[i] = video.Id
+		episodeIndex[video.Id] = i
+		analytics.Episodes[i].VideoId = video.Id
+	}
+
+	// Which episodes every viewer watched
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.D{{"video_id", bson.D{{"$in", videoIds}}}, countedWatchFilter()}}},
+		{{"$group", bson.D{
+			{"_id", "$user_id"},
+			{"episodes", bson.D{{"$addToSet", "$video_id"}}},
+		}}},
+	}
+	// Every user's watches are in one database, so viewers of different databases are different users
+	var viewers []struct {
+		Episodes []int64 `bson:"episodes"`
+	}
+	for _, residency := range residencies() {
+		_, _, watched, watchedArchive := residentEvents(residency)
+		cursor, err := watched.Aggregate(ctx.UserContext(), withArchivedEvents(pipeline, watchedArchive))
+		if err != nil {
+			return err
+		}
+		var residentViewers []struct {
+			Episodes []int64 `bson:"episodes"`
+		}
+		err = cursor.All(ctx.UserContext(), &residentViewers)
+		if err != nil {
+			return err
+		}
+		viewers = append(viewers, residentViewers...)
+	}
+
+	var startedSeries, finishedSeries int64
+	for _, viewer := range viewers {
+		watched := make([]bool, len(videos))
+		for _, videoId := range viewer.Episodes {
+			watched[episodeIndex[videoId]] = true
+		}
+		for i := range watched {
+			if !watched[i] {
+				continue
+			}
+			analytics.Episodes[i].Viewers++
+			if i > 0 && watched[i-1] {
+				analytics.Episodes[i].Retained++
+			}
+		}
+		if watched[0] {
+			startedSeries++
+			if watched[len(watched)-1] {
+				finishedSeries++
+			}
+		}
+	}
+
+	// Watch counts per episode
+	pipeline = mongo.Pipeline{
+		{{"$match", bson.D{{"video_id", bson.D{{"$in", videoIds}}}, countedWatchFilter()}}},
+		{{"$group", bson.D{{"_id", "$video_id"}, {"watches", bson.D{{"$sum", watchWeightExpression()}}}}}},
+	}
+	episodeWatches := make([]float64, len(videos))
+	for _, residency := range residencies() {
+		_, _, watched, watchedArchive := residentEvents(residency)
+		cursor, err := watched.Aggregate(ctx.UserContext(), withArchivedEvents(pipeline, watchedArchive))
+		if err != nil {
+			return err
+		}
+		var results []struct {
+			VideoId int64   `bson:"_id"`
+			Watches float64 `bson:"watches"`
+		}
+		err = cursor.All(ctx.UserContext(), &results)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			episodeWatches[episodeIndex[result.VideoId]] += result.Watches
+		}
+	}
+	for i, weighted := range episodeWatches {
+		watches := int64(math.Round(weighted))
+		analytics.Episodes[i].Watches = watches
+		analytics.Watches += watches
+	}
+
+	for i := 1; i < len(analytics.Episodes); i++ {
+		previousViewers := analytics.Episodes[i-1].Viewers
+		if previousViewers > 0 {
+			analytics.Episodes[i].DropOff = 1 - float64(analytics.Episodes[i].Retained)/float64(previousViewers)
+		}
+	}
+	if startedSeries > 0 {
+		analytics.CompletionRate = float64(finishedSeries) / float64(startedSeries)
+	}
+	return ctx.JSON(analytics)
+}
+
+// Episodes of the creator's managed series are in their order, free text series are ordered by upload. Free text
+// names aren't unique, only the creator's own videos with the name are episodes.
+func seriesEpisodes(creatorId int64, series string) ([]Video, error) {
+	if seriesId, err := strconv.ParseInt(series, 10, 64); err == nil {
+		managed, err := getSeries(seriesId)
+		if err == nil && managed.CreatorId == creatorId {
+			return getVideosInOrder(mctx, managed.Videos)
+		}
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+
+	filter := bson.D{{"series", series}, {"creator_id", creatorId}}
+	cursor, err := videosCollection.Find(mctx, filter, options.Find().SetSort(bson.D{{"_id", 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var videos []Video
+	err = cursor.All(mctx, &videos)
+	return videos, err
+}
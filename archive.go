@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const archiveBatchSize = 1000
+
+// Moves like and watch events older than event_archive_after into cold collections
+func startEventArchiving() {
+	if config.eventArchiveAfter == 0 {
+		return
+	}
+	for _, residency := range residencies() {
+		_, likedArchive, _, watchedArchive := residentEvents(residency)
+		for _, archive := range []*mongo.Collection{likedArchive, watchedArchive} {
+			_, err := archive.Indexes().CreateOne(mctx, mongo.IndexModel{
+				Keys: bson.D{{"user_id", 1}, {"video_id", 1}},
+			})
+			if err != nil {
+				log.Print(err)
+			}
+		}
+	}
+
+	every(config.eventArchiveInterval, func() {
+		cutoff := time.Now().Add(-config.eventArchiveAfter)
+		for _, residency := range residencies() {
+			liked, likedArchive, watched, watchedArchive := residentEvents(residency)
+			for _, tier := range []struct{ hot, cold *mongo.Collection }{
+				{liked, likedArchive},
+				{watched, watchedArchive},
+			} {
+				moved, err := archiveEvents(tier.hot, tier.cold, cutoff)
+				if err != nil {
+					log.Print(err)
+				}
+				if moved > 0 {
+					log.Printf("Archived %d events from %s in the %s database", moved, tier.hot.Name(), databaseLabel(residency))
+				}
+			}
+		}
+	})
+}
+
+// Copies before deleting so a failure part way through leaves events in both tiers rather than neither,
+// replacing by id makes the copy safe to repeat. Events stored before they had a time are aged by their ObjectId.
+func archiveEvents(hot *mongo.Collection, cold *mongo.Collection, cutoff time.Time) (int64, error) {
+	old := bson.D{{"$or", bson.A{
+		bson.D{{"time", bson.D{{"$lt", cutoff}}}},
+		bson.D{{"time", bson.D{{"$exists", false}}}, {"_id", bson.D{{"$lt", primitive.NewObjectIDFromTimestamp(cutoff)}}}},
+	}}}
+	var moved int64
+	for {
+		cursor, err := hot.Find(mctx, old, options.Find().SetSort(bson.D{{"time", 1}, {"_id", 1}}).SetLimit(archiveBatchSize))
+		if err != nil {
+			return moved, err
+		}
+		var events []bson.M
+		err = cursor.All(mctx, &events)
+		if err != nil {
+			return moved, err
+		}
+		if len(events) == 0 {
+			return moved, nil
+		}
+
+		writes := make([]mongo.WriteModel, len(events))
+		ids := make(bson.A, len(events))
+		for i, event := range events {
+			writes[i] = mongo.NewReplaceOneModel().SetFilter(bson.D{{"_id", event["_id"]}}).SetReplacement(event).SetUpsert(true)
+			ids[i] = event["_id"]
+		}
+		_, err = cold.BulkWrite(mctx, writes, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return moved, err
+		}
+		result, err := hot.DeleteMany(mctx, bson.D{{"_id", bson.D{{"$in", ids}}}})
+		if err != nil {
+			return moved, err
+		}
+		moved += result.DeletedCount
+	}
+}
+
+// Checks the hot collection first as almost all lookups are for recent events
+func hasEvent(hot *mongo.Collection, cold *mongo.Collection, userId int64, videoId int64) bool {
+	filter := bson.D{{"user_id", userId}, {"video_id", videoId}}
+	var limit int64 = 1
+	for _, collection := range []*mongo.Collection{hot, cold} {
+		documentCount, err := collection.CountDocuments(mctx, filter, &options.CountOptions{
+			Limit: &limit,
+		})
+		if err != nil || documentCount == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Makes an aggregation over events include the archived ones, the pipeline has to start with a $match
+func withArchivedEvents(pipeline mongo.Pipeline, cold *mongo.Collection) mongo.Pipeline {
+	unionWith := bson.D{{"$unionWith", bson.D{{"coll", cold.Name()}, {"pipeline", mongo.Pipeline{pipeline[0]}}}}}
+	return append(mongo.Pipeline{pipeline[0], unionWith}, pipeline[1:]...)
+}
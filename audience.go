@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// Only this many engaged users are profiled, which is plenty for the shape of an audience
+	maxAudienceSample = 10000
+	// Smaller audiences aren't summarized as the profile would say too much about individual users
+	minAudienceSize       = 10
+	audienceInterestLimit = 25
+)
+
+type AudienceInterest struct {
+	Tag   string  `json:"tag"`
+	Users int64   `json:"users"`
+	Share float64 `json:"share"`
+}
+
+type AudienceInsights struct {
+	AudienceSize int64              `json:"audience_size"`
+	Interests    []AudienceInterest `json:"interests"`
+}
+
+// Users who liked or commented on any of the videos
+func engagedUsers(videoIds []int64) ([]int64, error) {
+	seen := make(map[int64]bool)
+	userIds := make([]int64, 0)
+	collections := make([]*mongo.Collection, 0)
+	for _, residency := range residencies() {
+		liked, likedArchive, _, _ := residentEvents(residency)
+		collections = append(collections, liked, likedArchive)
+	}
+	collections = append(collections, commentsCollection)
+	for _, collection := range collections {
+		pipeline := mongo.Pipeline{
+			{{"$match", bson.D{{"video_id", bson.D{{"$in", videoIds}}}}}},
+			{{"$group", bson.D{{"_id", "$user_id"}}}},
+			{{"$limit", maxAudienceSample}},
+		}
+		cursor, err := collection.Aggregate(mctx, pipeline)
+		if err != nil {
+			return nil, err
+		}
+		var users []struct {
+			UserId int64 `bson:"_id"`
+		}
+		err = cursor.All(mctx, &users)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			if !seen[user.UserId] && len(userIds) < maxAudienceSample {
+				seen[user.UserId] = true
+				userIds = append(userIds, user.UserId)
+			}
+		}
+	}
+	return userIds, nil
+}
+
+func getAudienceInsights(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	results, err := videosCollection.Distinct(ctx.UserContext(), "_id", bson.D{creatorFilter(userId)})
+	if err != nil {
+		return err
+	}
+	videoIds := make([]int64, len(results))
+	for i, result := range results {
+		videoIds[i] = result.(int64)
+	}
+	insights := AudienceInsights{Interests: make([]AudienceInterest, 0)}
+	if len(videoIds) == 0 {
+		return ctx.JSON(insights)
+	}
+
+	audience, err := engagedUsers(videoIds)
+	if err != nil {
+		return err
+	}
+	insights.AudienceSize = int64(len(audience))
+	if insights.AudienceSize < minAudienceSize {
+		return ctx.JSON(insights)
+	}
+
+	// How many of the audience have a positive interest in each tag
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.D{{"_id", bson.D{{"$in", audience}}}}}},
+		{{"$project", bson.D{{"interests", bson.D{{"$objectToArray", bson.D{{"$ifNull", bson.A{"$interests", bson.D{}}}}}}}}}},
+		{{"$unwind", "$interests"}},
+		{{"$match", bson.D{{"interests.v", bson.D{{"$gt", 0}}}}}},
+		{{"$group", bson.D{{"_id", "$interests.k"}, {"users", bson.D{{"$sum", 1}}}}}},
+		{{"$sort", bson.D{{"users", -1}, {"_id", 1}}}},
+		{{"$limit", audienceInterestLimit}},
+	}
+	cursor, err := usersCollection.Aggregate(ctx.UserContext(), pipeline)
+	if err != nil {
+		return err
+	}
+	var tags []struct {
+		Tag   string `bson:"_id"`
+		Users int64  `bson:"users"`
+	}
+	err = cursor.All(ctx.UserContext(), &tags)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		insights.Interests = append(insights.Interests, AudienceInterest{
+			Tag:   tag.Tag,
+			Users: tag.Users,
+			Share: float64(tag.Users) / float64(insights.AudienceSize),
+		})
+	}
+	return ctx.JSON(insights)
+}
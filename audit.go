@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Inserts racing for the same place in the chain retry this many times
+const auditInsertAttempts = 10
+
+type AuditEntry struct {
+	ActorId    int64     `bson:"actor_id" json:"actor_id"`
+	Action     string    `bson:"action" json:"action"`
+	TargetType string    `bson:"target_type" json:"target_type"`
+	Target     string    `bson:"target" json:"target"`
+	Reason     string    `bson:"reason" json:"reason"`
+	Time       time.Time `bson:"time" json:"time"`
+
+	// Every entry hashes the one before it, entries from before chaining have no sequence
+	Sequence     int64  `bson:"sequence,omitempty" json:"sequence,omitempty"`
+	PreviousHash string `bson:"previous_hash,omitempty" json:"previous_hash,omitempty"`
+	Hash         string `bson:"hash,omitempty" json:"hash,omitempty"`
+}
+
+type AuditVerification struct {
+	Valid    bool  `json:"valid"`
+	Verified int64 `json:"verified"`
+	// Entries recorded before the log was chained, these can't be verified
+	Unchained       int64  `json:"unchained"`
+	InvalidSequence int64  `json:"invalid_sequence,omitempty"`
+	Problem         string `json:"problem,omitempty"`
+}
+
+func createAuditIndex() {
+	_, err := auditCollection.Indexes().CreateOne(mctx, mongo.IndexModel{
+		Keys:    bson.D{{"sequence", 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{{"sequence", bson.D{{"$exists", true}}}}),
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func (entry AuditEntry) computeHash() string {
+	sum := sha256.New()
+	for _, field := range []string{
+		entry.PreviousHash,
+		strconv.FormatInt(entry.Sequence, 10),
+		strconv.FormatInt(entry.ActorId, 10),
+		entry.Action,
+		entry.TargetType,
+		entry.Target,
+		entry.Reason,
+		entry.Time.UTC().Format(time.RFC3339Nano),
+	} {
+		// Length prefixed so moving text between fields changes the hash
+		sum.Write([]byte(strconv.Itoa(len(field)) + ":" + field))
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func lastAuditEntry() (AuditEntry, error) {
+	var last AuditEntry
+	err := auditCollection.FindOne(mctx, bson.D{{"sequence", bson.D{{"$exists", true}}}}, options.FindOne().SetSort(bson.D{{"sequence", -1}})).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return last, nil
+	}
+	return last, err
+}
+
+// Audit log entries are only ever inserted, never updated or removed.
+// The unique sequence makes concurrent inserts take turns extending the chain.
+func recordAudit(actorId int64, action string, targetType string, target string, reason string) error {
+	entry := AuditEntry{
+		ActorId:    actorId,
+		Action:     action,
+		TargetType: targetType,
+		Target:     target,
+		Reason:     reason,
+		// Mongo keeps milliseconds, the hash has to match what is read back
+		Time: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	var err error
+	for attempt := 0; attempt < auditInsertAttempts; attempt++ {
+		var last AuditEntry
+		last, err = lastAuditEntry()
+		if err != nil {
+			return err
+		}
+		entry.Sequence = last.Sequence + 1
+		entry.PreviousHash = last.Hash
+		entry.Hash = entry.computeHash()
+		_, err = auditCollection.InsertOne(mctx, entry)
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// Walks the chain from the start, any edited, removed or reordered entry breaks it
+func verifyAudit(ctx *fiber.Ctx) error {
+	var verification AuditVerification
+	unchained, err := auditCollection.CountDocuments(ctx.UserContext(), bson.D{{"sequence", bson.D{{"$exists", false}}}})
+	if err != nil {
+		return err
+	}
+	verification.Unchained = unchained
+
+	cursor, err := auditCollection.Find(ctx.UserContext(), bson.D{{"sequence", bson.D{{"$exists", true}}}}, options.Find().SetSort(bson.D{{"sequence", 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx.UserContext())
+	previous := AuditEntry{}
+	for cursor.Next(ctx.UserContext()) {
+		var entry AuditEntry
+		err = cursor.Decode(&entry)
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.Sequence != previous.Sequence+1:
+			verification.Problem = "missing entries before this one"
+		case entry.PreviousHash != previous.Hash:
+			verification.Problem = "doesn't follow the entry before it"
+		case entry.Hash != entry.computeHash():
+			verification.Problem = "contents don't match its hash"
+		}
+		if verification.Problem != "" {
+			verification.InvalidSequence = entry.Sequence
+			return ctx.JSON(verification)
+		}
+		verification.Verified++
+		previous = entry
+	}
+	if cursor.Err() != nil {
+		return cursor.Err()
+	}
+	verification.Valid = true
+	return ctx.JSON(verification)
+}
+
+func listAudit(ctx *fiber.Ctx) error {
+	filter := bson.D{}
+	if actor := ctx.Query("actor_id"); actor != "" {
+		actorId, err := strconv.ParseInt(actor, 10, 64)
+		if err != nil {
+			return err
+		}
+		filter = append(filter, bson.E{Key: "actor_id", Value: actorId})
+	}
+	for _, field := range []string{"action", "target_type", "target"} {
+		if value := ctx.Query(field); value != "" {
+			filter = append(filter, bson.E{Key: field, Value: value})
+		}
+	}
+	timeRange, err := queryTimeRange(ctx)
+	if err != nil {
+		return err
+	}
+	if len(timeRange) > 0 {
+		filter = append(filter, bson.E{Key: "time", Value: timeRange})
+	}
+
+	limit, err := strconv.ParseInt(ctx.Query("limit", "50"), 10, 64)
+	if err != nil {
+		return err
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 500
+	}
+
+	cursor, err := auditCollection.Find(ctx.UserContext(), filter, options.Find().SetSort(bson.D{{"time", -1}}).SetLimit(limit))
+	if err != nil {
+		return err
+	}
+	entries := make([]AuditEntry, 0)
+	err = cursor.All(ctx.UserContext(), &entries)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(entries)
+}
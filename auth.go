@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const jwksRefreshInterval = time.Hour
+
+var (
+	errInvalidToken = errors.New("invalid token")
+	errTokenExpired = errors.New("token expired")
+)
+
+var (
+	jwks     = make(map[string]*rsa.PublicKey)
+	jwksLock sync.RWMutex
+)
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Issuer    string       `json:"iss"`
+	ExpiresAt *json.Number `json:"exp"`
+	NotBefore *json.Number `json:"nbf"`
+	// Everything, to read the configured user id claim from
+	all map[string]interface{}
+}
+
+func authEnabled() bool {
+	return config.jwtSecret != "" || config.jwksUrl != ""
+}
+
+func initAuth() {
+	if !authEnabled() {
+		log.Print("User authentication is disabled, set jwt_secret or jwks_url to enable it")
+		return
+	}
+	if config.jwksUrl == "" {
+		return
+	}
+	err := refreshJwks()
+	if err != nil {
+		log.Fatalf("Couldn't load signing keys from %s: %s", config.jwksUrl, err)
+	}
+	every(jwksRefreshInterval, func() {
+		err := refreshJwks()
+		if err != nil {
+			log.Print(err)
+		}
+	})
+}
+
+func refreshJwks() error {
+	response, err := httpClient.Get(config.jwksUrl)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		return fmt.Errorf("jwks endpoint responded with %d", response.StatusCode)
+	}
+	var keySet struct {
+		Keys []struct {
+			KeyType  string `json:"kty"`
+			KeyId    string `json:"kid"`
+			Modulus  string `json:"n"`
+			Exponent string `json:"e"`
+		} `json:"keys"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&keySet)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range keySet.Keys {
+		if key.KeyType != "RSA" {
+			continue
+		}
+		modulus, err := base64.RawURLEncoding.DecodeString(key.Modulus)
+		if err != nil {
+			return err
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(key.Exponent)
+		if err != nil {
+			return err
+		}
+		keys[key.KeyId] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}
+	}
+	jwksLock.Lock()
+	jwks = keys
+	jwksLock.Unlock()
+	return nil
+}
+
+// Checks the signature and time claims, HS256 tokens are signed with the shared secret and RS256 ones with a key from the JWKS
+func verifyToken(token string) (jwtClaims, error) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errInvalidToken
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, errInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errInvalidToken
+	}
+	var header jwtHeader
+	err = json.Unmarshal(rawHeader, &header)
+	if err != nil {
+		return claims, errInvalidToken
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Algorithm == "HS256" && config.jwtSecret != "":
+		mac := hmac.New(sha256.New, []byte(config.jwtSecret))
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return claims, errInvalidToken
+		}
+	case header.Algorithm == "RS256" && config.jwksUrl != "":
+		jwksLock.RLock()
+		key, exists := jwks[header.KeyId]
+		jwksLock.RUnlock()
+		if !exists {
+			return claims, errInvalidToken
+		}
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return claims, errInvalidToken
+		}
+	default:
+		return claims, errInvalidToken
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, errInvalidToken
+	}
+	decoder := json.NewDecoder(bytes.NewReader(rawClaims))
+	decoder.UseNumber()
+	err = decoder.Decode(&claims.all)
+	if err != nil {
+		return claims, errInvalidToken
+	}
+	err = json.Unmarshal(rawClaims, &claims)
+	if err != nil {
+		return claims, errInvalidToken
+	}
+
+	now := time.Now().Unix()
+	if claims.ExpiresAt != nil {
+		expiresAt, err := claims.ExpiresAt.Int64()
+		if err != nil || now >= expiresAt {
+			return claims, errTokenExpired
+		}
+	}
+	if claims.NotBefore != nil {
+		notBefore, err := claims.NotBefore.Int64()
+		if err != nil || now < notBefore {
+			return claims, errInvalidToken
+		}
+	}
+	if config.jwtIssuer != "" && claims.Issuer != config.jwtIssuer {
+		return claims, errInvalidToken
+	}
+	return claims, nil
+}
+
+// The user id claim as a string, it may be sent as either a string or a number
+func (claims jwtClaims) userId() string {
+	switch value := claims.all[config.jwtUserClaim].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	}
+	return ""
+}
+
+// Rejects requests without a valid token for the user in the path
+func userAuth(ctx *fiber.Ctx) error {
+	token := strings.TrimPrefix(ctx.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return fiber.NewError(401, "Missing token")
+	}
+	claims, err := verifyToken(token)
+	if err == errTokenExpired {
+		return fiber.NewError(401, "Token expired")
+	}
+	if err != nil {
+		return fiber.NewError(401, "Invalid token")
+	}
+	if claims.userId() == "" || claims.userId() != ctx.Params("user_id") {
+		return fiber.NewError(403, "Token is for another user")
+	}
+	userId, err := strconv.ParseInt(claims.userId(), 10, 64)
+	if err != nil {
+		return err
+	}
+	ctx.Locals("viewer_id", userId)
+	return ctx.Next()
+}
+
+// The user making the request, 0 for anonymous viewers. With auth enabled it comes from the token, which routes
+// that only read public data don't require, so a missing or invalid one leaves the viewer anonymous.
+// Without auth viewers pass themselves as ?viewer_id=, just as users in paths are trusted.
+func viewerId(ctx *fiber.Ctx) int64 {
+	if !authEnabled() {
+		return queryUserId(ctx, "viewer_id")
+	}
+	if viewer, ok := ctx.Locals("viewer_id").(int64); ok {
+		return viewer
+	}
+	var viewer int64
+	token := strings.TrimPrefix(ctx.Get("Authorization"), "Bearer ")
+	if token != "" {
+		claims, err := verifyToken(token)
+		if err == nil {
+			viewer, _ = strconv.ParseInt(claims.userId(), 10, 64)
+		}
+	}
+	ctx.Locals("viewer_id", viewer)
+	return viewer
+}
+
+// Reads of what a user made public, which anyone can make. The owner is recognised by viewerId instead.
+var publicUserRoutes = map[string]bool{
+	"/playlists/:user_id": true,
+}
+
+// Every other route with a :user_id acts as that user, so needs their token. Admin and internal routes have their own auth.
+// Called after all routes are registered, since middleware added with Use can't see route params.
+func requireUserTokens() {
+	if !authEnabled() {
+		return
+	}
+	for _, routes := range app.Stack() {
+		for _, route := range routes {
+			if strings.HasPrefix(route.Path, "/admin") || strings.HasPrefix(route.Path, "/internal") {
+				continue
+			}
+			if publicUserRoutes[route.Path] && (route.Method == fiber.MethodGet || route.Method == fiber.MethodHead) {
+				continue
+			}
+			for _, param := range route.Params {
+				if param == "user_id" {
+					route.Handlers = append([]fiber.Handler{userAuth}, route.Handlers...)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Blocked terms for a market, which is global, lang:<language> or country:<country code>
+type Blocklist struct {
+	Market    string    `bson:"_id" json:"market"`
+	Terms     []string  `bson:"terms" json:"terms"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type BlocklistUpdate struct {
+	Terms  []string `json:"terms"`
+	Reason string   `json:"reason"`
+}
+
+var (
+	blocklists     = make(map[string][]string)
+	blocklistsLock sync.RWMutex
+)
+
+// Loads the blocklists now and again every interval, so changes made through another instance are picked up
+func startBlocklists() {
+	err := loadBlocklists()
+	if err != nil {
+		log.Print(err)
+	}
+	every(config.blocklistReloadInterval, func() {
+		err := loadBlocklists()
+		if err != nil {
+			log.Print(err)
+		}
+	})
+}
+
+func loadBlocklists() error {
+	cursor, err := blocklistsCollection.Find(mctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	var stored []Blocklist
+	err = cursor.All(mctx, &stored)
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string][]string)
+	for _, blocklist := range stored {
+		terms := make([]string, 0, len(blocklist.Terms))
+		for _, term := range blocklist.Terms {
+			if term = normalizeBlockedText(term); term != "" {
+				terms = append(terms, term)
+			}
+		}
+		loaded[blocklist.Market] = terms
+	}
+	blocklistsLock.Lock()
+	blocklists = loaded
+	blocklistsLock.Unlock()
+	return nil
+}
+
+// Lowercase words separated by single spaces, so terms only match whole words
+func normalizeBlockedText(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// Checks the text against the global list and the lists of its language and the country, either may be empty
+func containsBlockedTerm(text string, language string, country string) bool {
+	markets := []string{"global"}
+	if language != "" {
+		markets = append(markets, "lang:"+language)
+	}
+	if country != "" {
+		markets = append(markets, "country:"+country)
+	}
+	padded := " " + normalizeBlockedText(text) + " "
+
+	blocklistsLock.RLock()
+	defer blocklistsLock.RUnlock()
+	for _, market := range markets {
+		for _, term := range blocklists[market] {
+			if strings.Contains(padded, " "+term+" ") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Descriptions that are spam or use blocked terms are held for moderation
+func shouldHoldDescription(description string, language string) bool {
+	return isSpam(description) || containsBlockedTerm(description, language, "")
+}
+
+func registerBlocklistRoutes(admin fiber.Router) {
+	admin.Get("/blocklists", func(ctx *fiber.Ctx) error {
+		cursor, err := blocklistsCollection.Find(ctx.UserContext(), bson.D{})
+		if err != nil {
+			return err
+		}
+		stored := make([]Blocklist, 0)
+		err = cursor.All(ctx.UserContext(), &stored)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(stored)
+	})
+	admin.Put("/blocklists/:market", func(ctx *fiber.Ctx) error {
+		var update BlocklistUpdate
+		err := ctx.BodyParser(&update)
+		if err != nil {
+			return err
+		}
+		market := ctx.Params("market")
+		if market != "global" && !strings.HasPrefix(market, "lang:") && !strings.HasPrefix(market, "country:") {
+			return fiber.NewError(400, "Market must be global, lang:<language> or country:<country code>")
+		}
+		// Country codes are matched against the upper case region header
+		if country := strings.TrimPrefix(market, "country:"); country != market {
+			market = "country:" + strings.ToUpper(country)
+		}
+
+		blocklist := Blocklist{Market: market, Terms: update.Terms, UpdatedAt: time.Now()}
+		_, err = blocklistsCollection.ReplaceOne(ctx.UserContext(), bson.D{{"_id", market}}, blocklist, options.Replace().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+		err = loadBlocklists()
+		if err != nil {
+			return err
+		}
+		return recordAudit(adminId(ctx), "blocklist_update", "blocklist", market, update.Reason)
+	})
+	admin.Post("/blocklists/reload", func(ctx *fiber.Ctx) error {
+		return loadBlocklists()
+	})
+}
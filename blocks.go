@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Block struct {
+	Id        int64     `bson:"_id" json:"id"`
+	UserId    int64     `bson:"user_id" json:"user_id"`
+	BlockedId int64     `bson:"blocked_id" json:"blocked_id"`
+	Time      time.Time `bson:"time" json:"time"`
+}
+
+func isBlocked(userId int64, blockedId int64) (bool, error) {
+	var limit int64 = 1
+	count, err := blocksCollection.CountDocuments(mctx, bson.D{{"user_id", userId}, {"blocked_id", blockedId}}, &options.CountOptions{
+		Limit: &limit,
+	})
+	if err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
+// Users on either side of a block with the user, blocks hide videos in both directions
+func blockedUserIds(userId int64) ([]int64, error) {
+	cursor, err := blocksCollection.Find(mctx, bson.D{{"$or", bson.A{
+		bson.D{{"user_id", userId}},
+		bson.D{{"blocked_id", userId}},
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	var blocks []Block
+	err = cursor.All(mctx, &blocks)
+	if err != nil {
+		return nil, err
+	}
+	userIds := make([]int64, len(blocks))
+	for i, block := range blocks {
+		userIds[i] = block.BlockedId
+		if block.BlockedId == userId {
+			userIds[i] = block.UserId
+		}
+	}
+	return userIds, nil
+}
+
+// Filter excluding videos by users the viewer blocked or was blocked by
+func blockFilter(userId int64) (bson.D, error) {
+	userIds, err := blockedUserIds(userId)
+	if err != nil {
+		return nil, err
+	}
+	if len(userIds) == 0 {
+		return bson.D{}, nil
+	}
+	return bson.D{{"creator_id", bson.D{{"$nin", userIds}}}}, nil
+}
+
+// Anonymous viewers see everything
+func viewerBlockFilter(ctx *fiber.Ctx) (bson.D, error) {
+	viewer := viewerId(ctx)
+	if viewer == 0 {
+		return bson.D{}, nil
+	}
+	return blockFilter(viewer)
+}
+
+func registerBlockRoutes() {
+	app.Post("/block/:blocked_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		blockedId, err := strconv.ParseInt(ctx.Params("blocked_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		if userId == blockedId {
+			return fiber.NewError(400, "Users can't block themselves")
+		}
+
+		_, err = blocksCollection.UpdateOne(ctx.UserContext(),
+			bson.D{{"user_id", userId}, {"blocked_id", blockedId}},
+			bson.D{{"$setOnInsert", bson.D{{"_id", idNode.Generate().Int64()}, {"time", time.Now()}}}},
+			options.Update().SetUpsert(true),
+		)
+		return err
+	})
+	app.Delete("/block/:blocked_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		blockedId, err := strconv.ParseInt(ctx.Params("blocked_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		_, err = blocksCollection.DeleteOne(ctx.UserContext(), bson.D{{"user_id", userId}, {"blocked_id", blockedId}})
+		return err
+	})
+	app.Get("/blocks/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		filter, findOptions, err := paginate(ctx, bson.D{{"user_id", userId}})
+		if err != nil {
+			return err
+		}
+		cursor, err := blocksCollection.Find(ctx.UserContext(), filter, findOptions)
+		if err != nil {
+			return err
+		}
+		blocks := make([]Block, 0)
+		err = cursor.All(ctx.UserContext(), &blocks)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(blocks)
+	})
+}
+
+func createBlockIndex() {
+	_, err := blocksCollection.Indexes().CreateOne(mctx, mongo.IndexModel{
+		Keys:    bson.D{{"user_id", 1}, {"blocked_id", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Caption struct {
+	Language      string    `bson:"language" json:"language"`
+	Vtt           string    `bson:"vtt" json:"vtt"`
+	AutoGenerated bool      `bson:"auto_generated" json:"auto_generated"`
+	Time          time.Time `bson:"time" json:"time"`
+}
+
+// Sends the uploaded video to the speech to text service in the background, the service is expected
+// to extract the audio itself and respond with WebVTT
+func generateCaptions(video Video) {
+	if config.captionsUrl == "" {
+		return
+	}
+	background(func() {
+		err := requestCaptions(video)
+		if err != nil {
+			log.Printf("Failed to generate captions for video %d: %s", video.Id, err)
+		}
+	})
+}
+
+func requestCaptions(video Video) error {
+	stored, err := readStoredVideo(video.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer stored.Close()
+
+	query := url.Values{"format": {"vtt"}}
+	if video.Language != "" {
+		query.Set("language", video.Language)
+	}
+	request, err := http.NewRequest("POST", config.captionsUrl+"?"+query.Encode(), stored)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/octet-stream")
+	// Transcribing takes a lot longer than the shared client allows
+	client := &http.Client{Timeout: config.captionsTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("speech to text service responded with %d", response.StatusCode)
+	}
+	vtt, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	caption := Caption{
+		Language:      video.Language,
+		Vtt:           string(vtt),
+		AutoGenerated: true,
+		Time:          time.Now(),
+	}
+	// Replaces any earlier auto generated captions, but never ones the creator provided
+	_, err = videosCollection.UpdateOne(mctx, bson.D{{"_id", video.Id}}, bson.D{{"$pull", bson.D{{"captions", bson.D{{"auto_generated", true}}}}}})
+	if err != nil {
+		return err
+	}
+	_, err = videosCollection.UpdateOne(mctx, bson.D{{"_id", video.Id}}, bson.D{{"$push", bson.D{{"captions", caption}}}})
+	return err
+}
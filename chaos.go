@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// Fault injection for resilience testing in staging, never enable it in production
+
+var errInjectedFault = errors.New("injected fault")
+
+// Waits the configured latency and fails at the configured rate, does nothing unless chaos mode is on
+func injectFault() error {
+	if !config.chaosMode {
+		return nil
+	}
+	if config.chaosLatency > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(config.chaosLatency))))
+	}
+	if rand.Float64() < config.chaosErrorRate {
+		return errInjectedFault
+	}
+	return nil
+}
+
+// Mongo connections that drop at the injected error rate, so the driver sees real network errors and retries
+type chaosDialer struct {
+	dialer net.Dialer
+}
+
+func (dialer *chaosDialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	conn, err := dialer.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &chaosConn{Conn: conn}, nil
+}
+
+type chaosConn struct {
+	net.Conn
+}
+
+func (conn *chaosConn) Write(b []byte) (int, error) {
+	if err := injectFault(); err != nil {
+		conn.Conn.Close()
+		return 0, err
+	}
+	return conn.Conn.Write(b)
+}
+
+func initChaos() {
+	if !config.chaosMode {
+		return
+	}
+	log.Printf("Chaos mode is on: up to %s latency and a %.0f%% error rate on mongo and storage calls", config.chaosLatency, config.chaosErrorRate*100)
+}
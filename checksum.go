@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+var errChecksumMismatch = errors.New("checksum does not match the uploaded file")
+
+func sha256Hex(reader io.Reader) (string, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, reader)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Uploads without a checksum are not verified
+func verifyChecksum(reader io.Reader, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	actual, err := sha256Hex(reader)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, expected) {
+		return errChecksumMismatch
+	}
+	return nil
+}
+
+func verifyStoredChecksum(storageKey string, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	stored, err := readStoredVideo(storageKey)
+	if err != nil {
+		return err
+	}
+	defer stored.Close()
+	return verifyChecksum(stored, expected)
+}
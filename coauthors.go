@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	coAuthorPending  = "pending"
+	coAuthorAccepted = "accepted"
+	coAuthorDeclined = "declined"
+)
+
+// Every credited co-author has to accept before being shown on the video
+func pendingCoAuthors(creatorId int64, coAuthors []CoAuthor) []CoAuthor {
+	pending := make([]CoAuthor, 0, len(coAuthors))
+	seen := make(map[int64]bool)
+	for _, coAuthor := range coAuthors {
+		if coAuthor.UserId == creatorId || seen[coAuthor.UserId] {
+			continue
+		}
+		seen[coAuthor.UserId] = true
+		pending = append(pending, CoAuthor{UserId: coAuthor.UserId, Status: coAuthorPending})
+	}
+	return pending
+}
+
+func coAuthorsFromUpload(upload VideoUpload) []CoAuthor {
+	coAuthors := make([]CoAuthor, len(upload.CoAuthors))
+	for i, userId := range upload.CoAuthors {
+		coAuthors[i] = CoAuthor{UserId: userId}
+	}
+	return coAuthors
+}
+
+// Filter matching videos created by or credited to the user
+func creatorFilter(userId int64) bson.E {
+	return bson.E{Key: "$or", Value: bson.A{
+		bson.D{{"creator_id", userId}},
+		bson.D{{"co_authors", bson.D{{"$elemMatch", bson.D{{"user_id", userId}, {"status", coAuthorAccepted}}}}}},
+	}}
+}
+
+func respondToCoAuthorship(ctx *fiber.Ctx, status string) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{{"_id", videoId}, {"co_authors.user_id", userId}}
+	update := bson.D{{"$set", bson.D{{"co_authors.$.status", status}}}}
+	result, err := videosCollection.UpdateOne(ctx.UserContext(), filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fiber.NewError(404, "User is not credited on this video")
+	}
+	return nil
+}
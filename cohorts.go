@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	week         = 7 * 24 * time.Hour
+	rollupCursor = "creator_viewers"
+)
+
+// Weeks start on monday, the 5th of january 1970 was the first one
+var firstWeek = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+
+// CreatorViewer is the roll-up of which weeks a user watched a creator in, and which video brought them in
+type CreatorViewer struct {
+	Id                 string      `bson:"_id" json:"-"`
+	CreatorId          int64       `bson:"creator_id" json:"creator_id"`
+	UserId             int64       `bson:"user_id" json:"user_id"`
+	AcquisitionVideoId int64       `bson:"acquisition_video_id" json:"acquisition_video_id"`
+	FirstWeek          time.Time   `bson:"first_week" json:"first_week"`
+	Weeks              []time.Time `bson:"weeks" json:"weeks"`
+}
+
+type Cohort struct {
+	VideoId  int64     `bson:"video_id" json:"video_id"`
+	Week     time.Time `bson:"week" json:"week"`
+	Users    int64     `bson:"users" json:"users"`
+	Retained int64     `bson:"retained" json:"retained"`
+	Rate     float64   `bson:"-" json:"rate"`
+}
+
+func startRollups() {
+	_, err := creatorViewersCollection.Indexes().CreateOne(mctx, mongo.IndexModel{
+		Keys: bson.D{{"creator_id", 1}, {"acquisition_video_id", 1}},
+	})
+	if err != nil {
+		log.Print(err)
+	}
+
+	every(config.rollupInterval, func() {
+		err := rollupCreatorViewers(time.Now())
+		if err != nil {
+			log.Print(err)
+		}
+	})
+}
+
+// Rolls up the watches since the last run, the cursor is only moved on once everything up to now is stored
+func rollupCreatorViewers(until time.Time) error {
+	var cursorState struct {
+		Until time.Time `bson:"until"`
+	}
+	err := rollupCursorsCollection.FindOne(mctx, bson.D{{"_id", rollupCursor}}).Decode(&cursorState)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	for _, residency := range residencies() {
+		_, _, watched, watchedArchive := residentEvents(residency)
+		err = rollupResidentViewers(watched, watchedArchive, cursorState.Until, until)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = rollupCursorsCollection.UpdateOne(mctx, bson.D{{"_id", rollupCursor}}, bson.D{{"$set", bson.D{{"until", until}}}}, options.Update().SetUpsert(true))
+	return err
+}
+
+// Regional databases have no videos to look creators up in, so watches are grouped per video and user there and
+// creators are looked up a batch at a time. Groups are written in the order of their first watch, so the earliest
+// video is the one that inserts the viewer and becomes its acquisition video.
+func rollupResidentViewers(watched *mongo.Collection, watchedArchive *mongo.Collection, since time.Time, until time.Time) error {
+	weekStart := bson.D{{"$subtract", bson.A{"$time", bson.D{{"$mod", bson.A{
+		bson.D{{"$subtract", bson.A{"$time", firstWeek}}},
+		week.Milliseconds(),
+	}}}}}}
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.D{{"time", bson.D{{"$gte", since}, {"$lt", until}}}, countedWatchFilter()}}},
+		{{"$group", bson.D{
+			{"_id", bson.D{{"video_id", "$video_id"}, {"user_id", "$user_id"}}},
+			{"first_time", bson.D{{"$min", "$time"}}},
+			{"first_week", bson.D{{"$min", weekStart}}},
+			{"weeks", bson.D{{"$addToSet", weekStart}}},
+		}}},
+		{{"$sort", bson.D{{"first_time", 1}}}},
+	}
+	cursor, err := watched.Aggregate(mctx, withArchivedEvents(pipeline, watchedArchive), options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(mctx)
+
+	type viewerRollup struct {
+		Id struct {
+			VideoId int64 `bson:"video_id"`
+			UserId  int64 `bson:"user_id"`
+		} `bson:"_id"`
+		FirstWeek time.Time   `bson:"first_week"`
+		Weeks     []time.Time `bson:"weeks"`
+	}
+	batch := make([]viewerRollup, 0, snapshotBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		videoIds := make([]int64, len(batch))
+		for i, rollup := range batch {
+			videoIds[i] = rollup.Id.VideoId
+		}
+		videos, err := getVideosInOrder(mctx, videoIds)
+		if err != nil {
+			return err
+		}
+		creators := make(map[int64]int64)
+		for _, video := range videos {
+			creators[video.Id] = video.CreatorId
+		}
+
+		writes := make([]mongo.WriteModel, 0, len(batch))
+		for _, rollup := range batch {
+			creatorId, exists := creators[rollup.Id.VideoId]
+			if !exists {
+				continue
+			}
+			// Earlier runs already saw returning viewers, so acquisition is only set the first time
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.D{{"_id", fmt.Sprintf("%d:%d", creatorId, rollup.Id.UserId)}}).
+				SetUpdate(bson.D{
+					{"$setOnInsert", bson.D{
+						{"creator_id", creatorId},
+						{"user_id", rollup.Id.UserId},
+						{"acquisition_video_id", rollup.Id.VideoId},
+						{"first_week", rollup.FirstWeek},
+					}},
+					{"$addToSet", bson.D{{"weeks", bson.D{{"$each", rollup.Weeks}}}}},
+				}).
+				SetUpsert(true))
+		}
+		batch = batch[:0]
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err = creatorViewersCollection.BulkWrite(mctx, writes, options.BulkWrite().SetOrdered(true))
+		return err
+	}
+	for cursor.Next(mctx) {
+		var rollup viewerRollup
+		err = cursor.Decode(&rollup)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, rollup)
+		if len(batch) == snapshotBatchSize {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if cursor.Err() != nil {
+		return cursor.Err()
+	}
+	return flush()
+}
+
+// Viewers acquired in week N by each of the creator's videos, and how many of them came back in week N+1
+func getCohortRetention(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.D{{"creator_id", userId}}}},
+		{{"$group", bson.D{
+			{"_id", bson.D{{"video_id", "$acquisition_video_id"}, {"week", "$first_week"}}},
+			{"users", bson.D{{"$sum", 1}}},
+			{"retained", bson.D{{"$sum", bson.D{{"$cond", bson.A{
+				bson.D{{"$in", bson.A{bson.D{{"$add", bson.A{"$first_week", week.Milliseconds()}}}, "$weeks"}}},
+				1,
+				0,
+			}}}}}},
+		}}},
+		{{"$project", bson.D{{"_id", 0}, {"video_id", "$_id.video_id"}, {"week", "$_id.week"}, {"users", 1}, {"retained", 1}}}},
+		{{"$sort", bson.D{{"week", -1}, {"users", -1}}}},
+	}
+	cursor, err := creatorViewersCollection.Aggregate(ctx.UserContext(), pipeline)
+	if err != nil {
+		return err
+	}
+	cohorts := make([]Cohort, 0)
+	err = cursor.All(ctx.UserContext(), &cohorts)
+	if err != nil {
+		return err
+	}
+	for i := range cohorts {
+		cohorts[i].Rate = float64(cohorts[i].Retained) / float64(cohorts[i].Users)
+	}
+	return ctx.JSON(cohorts)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CommentLike struct {
+	CommentId int64     `bson:"comment_id" json:"comment_id"`
+	UserId    int64     `bson:"user_id" json:"user_id"`
+	Time      time.Time `bson:"time" json:"time"`
+}
+
+// The unique index is what stops a user liking a comment twice
+func createCommentLikeIndex() {
+	_, err := commentLikesCollection.Indexes().CreateOne(mctx, mongo.IndexModel{
+		Keys:    bson.D{{"comment_id", 1}, {"user_id", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func registerCommentLikeRoutes() {
+	app.Post("/comments/:video_id/:comment_id/like/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		comment, ok, err := getComment(ctx)
+		if !ok {
+			return err
+		}
+		video, err := getVideo(ctx.UserContext(), comment.VideoId)
+		if err != nil {
+			return err
+		}
+		blocked, err := isBlocked(video.CreatorId, userId)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return fiber.NewError(403, "User has been blocked by the creator")
+		}
+
+		_, err = commentLikesCollection.InsertOne(ctx.UserContext(), CommentLike{CommentId: comment.Id, UserId: userId, Time: time.Now()})
+		if mongo.IsDuplicateKeyError(err) {
+			return duplicateInteraction(ctx, "already_liked", "User has already liked this comment")
+		}
+		if err != nil {
+			return err
+		}
+
+		changes := bson.D{}
+		if userId == video.CreatorId {
+			changes = append(changes, bson.E{Key: "$set", Value: bson.D{{"liked_by_creator", true}}})
+		}
+		changes = append(changes, bson.E{Key: "$inc", Value: bson.D{{"likes", 1}}})
+		_, err = commentsCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", comment.Id}}, changes)
+		return err
+	})
+	app.Delete("/comments/:video_id/:comment_id/like/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		comment, ok, err := getComment(ctx)
+		if !ok {
+			return err
+		}
+
+		result, err := commentLikesCollection.DeleteOne(ctx.UserContext(), bson.D{{"comment_id", comment.Id}, {"user_id", userId}})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			return duplicateInteraction(ctx, "not_liked", "User has not liked this comment")
+		}
+
+		video, err := getVideo(ctx.UserContext(), comment.VideoId)
+		if err != nil {
+			return err
+		}
+		changes := bson.D{}
+		if userId == video.CreatorId {
+			changes = append(changes, bson.E{Key: "$set", Value: bson.D{{"liked_by_creator", false}}})
+		}
+		changes = append(changes, bson.E{Key: "$inc", Value: bson.D{{"likes", -1}}})
+		_, err = commentsCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", comment.Id}}, changes)
+		return err
+	})
+}
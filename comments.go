@@ -0,0 +1,381 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	commentsEveryone  = "everyone"
+	commentsFollowers = "followers"
+	commentsOff       = "off"
+)
+
+type CommentPolicyUpdate struct {
+	CommentPolicy string `json:"comment_policy"`
+}
+
+// Videos without a policy allow comments from everyone
+func canComment(video Video, userId int64) (bool, error) {
+	if userId == video.CreatorId {
+		return true, nil
+	}
+	blocked, err := isBlocked(video.CreatorId, userId)
+	if err != nil || blocked {
+		return false, err
+	}
+	switch video.CommentPolicy {
+	case commentsOff:
+		return false, nil
+	case commentsFollowers:
+		return isFollowing(userId, video.CreatorId)
+	default:
+		return true, nil
+	}
+}
+
+func isFollowing(userId int64, creatorId int64) (bool, error) {
+	var limit int64 = 1
+	count, err := followsCollection.CountDocuments(mctx, bson.D{{"user_id", userId}, {"following_id", creatorId}}, &options.CountOptions{
+		Limit: &limit,
+	})
+	if err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
+func setCommentPolicy(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var update CommentPolicyUpdate
+	err = ctx.BodyParser(&update)
+	if err != nil {
+		return err
+	}
+	if update.CommentPolicy != commentsEveryone && update.CommentPolicy != commentsFollowers && update.CommentPolicy != commentsOff {
+		return fiber.NewError(400, "Comment policy must be everyone, followers or off")
+	}
+
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err != nil {
+		return err
+	}
+	if video.CreatorId != userId {
+		return fiber.NewError(403, "Only the creator can change this video")
+	}
+
+	_, err = videosCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", videoId}}, bson.D{{"$set", bson.D{{"comment_policy", update.CommentPolicy}}}})
+	return err
+}
+
+const maxCommentLength = 500
+
+type Comment struct {
+	Id       int64      `bson:"_id" json:"id"`
+	VideoId  int64      `bson:"video_id" json:"video_id"`
+	UserId   int64      `bson:"user_id" json:"user_id"`
+	Text     string     `bson:"text" json:"text"`
+	Time     time.Time  `bson:"time" json:"time"`
+	EditedAt *time.Time `bson:"edited_at,omitempty" json:"edited_at,omitempty"`
+	Mentions []int64    `bson:"mentions,omitempty" json:"mentions,omitempty"`
+
+	Likes          int64 `bson:"likes" json:"likes"`
+	LikedByCreator bool  `bson:"liked_by_creator" json:"liked_by_creator"`
+
+	// Replies
+	ParentCommentId int64 `bson:"parent_comment_id,omitempty" json:"parent_comment_id,omitempty"`
+	Replies         int64 `bson:"replies" json:"replies"`
+
+	// Filled in for responses
+	AuthorVerified bool `bson:"-" json:"author_verified"`
+}
+
+type CommentInput struct {
+	Text            string `json:"text"`
+	ParentCommentId int64  `json:"parent_comment_id"`
+}
+
+func validCommentText(text string) bool {
+	text = strings.TrimSpace(text)
+	return text != "" && len(text) <= maxCommentLength
+}
+
+// Loads a comment on the video, returning ok=false with the error to respond with when it doesn't exist
+func getComment(ctx *fiber.Ctx) (Comment, bool, error) {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return Comment{}, false, err
+	}
+	commentId, err := strconv.ParseInt(ctx.Params("comment_id"), 10, 64)
+	if err != nil {
+		return Comment{}, false, err
+	}
+
+	var comment Comment
+	err = commentsCollection.FindOne(ctx.UserContext(), bson.D{{"_id", commentId}, {"video_id", videoId}}).Decode(&comment)
+	if err == mongo.ErrNoDocuments {
+		return Comment{}, false, fiber.NewError(404, "Comment not found")
+	}
+	if err != nil {
+		return Comment{}, false, err
+	}
+	return comment, true, nil
+}
+
+func registerCommentRoutes() {
+	app.Post("/comments/:video_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		var input CommentInput
+		err = ctx.BodyParser(&input)
+		if err != nil {
+			return err
+		}
+		if !validCommentText(input.Text) {
+			return fiber.NewError(400, "Comments must be between 1 and "+strconv.Itoa(maxCommentLength)+" characters")
+		}
+		if containsBlockedTerm(input.Text, detectLanguage(input.Text), viewerCountry(ctx)) {
+			return fiber.NewError(400, "Comment contains blocked words")
+		}
+
+		user, err := getUser(ctx.UserContext(), userId)
+		if err != nil {
+			return err
+		}
+		video, err := getVideo(ctx.UserContext(), videoId)
+		if err != nil {
+			return err
+		}
+		if video.TakenDown {
+			return fiber.NewError(410, "Video has been taken down")
+		}
+		if !availableIn(video, viewerCountry(ctx)) {
+			return fiber.NewError(451, "Video is not available in your region")
+		}
+		if !canView(video, userId) {
+			return fiber.NewError(403, "Video is private")
+		}
+		if video.AgeRestricted && !canViewAgeRestricted(user) {
+			return fiber.NewError(403, "Video is age restricted")
+		}
+		allowed, err := canComment(video, userId)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fiber.NewError(403, "Comments are restricted on this video")
+		}
+
+		if input.ParentCommentId != 0 {
+			parentCount, err := commentsCollection.CountDocuments(ctx.UserContext(), bson.D{{"_id", input.ParentCommentId}, {"video_id", videoId}})
+			if err != nil {
+				return err
+			}
+			if parentCount == 0 {
+				return fiber.NewError(404, "Parent comment not found")
+			}
+		}
+
+		mentions, err := resolveMentions(input.Text, userId)
+		if err != nil {
+			return err
+		}
+
+		comment := Comment{
+			Id:              idNode.Generate().Int64(),
+			VideoId:         videoId,
+			UserId:          userId,
+			Text:            strings.TrimSpace(input.Text),
+			Time:            time.Now(),
+			Mentions:        mentions,
+			ParentCommentId: input.ParentCommentId,
+		}
+		_, err = commentsCollection.InsertOne(ctx.UserContext(), comment)
+		if err != nil {
+			return err
+		}
+		notifyCommentMentions(comment, mentions)
+		if comment.ParentCommentId != 0 {
+			_, err = commentsCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", comment.ParentCommentId}}, bson.D{{"$inc", bson.D{{"replies", 1}}}})
+			if err != nil {
+				return err
+			}
+		}
+		adjustInterests(user, video, config.commentInterestWeight)
+		err = incrementCounter(video, "comments", 1)
+		if err != nil {
+			return err
+		}
+		comment.AuthorVerified = user.Verified
+		return ctx.JSON(comment)
+	})
+	app.Get("/comments/:video_id", func(ctx *fiber.Ctx) error {
+		video, ok, err := getViewableVideo(ctx, viewerId(ctx))
+		if !ok {
+			return err
+		}
+
+		filter, findOptions, err := paginateSorted(ctx, bson.D{{"video_id", video.Id}, {"parent_comment_id", bson.D{{"$exists", false}}}}, commentsCollection, commentSorts)
+		if err != nil {
+			return err
+		}
+		cursor, err := commentsCollection.Find(ctx.UserContext(), filter, findOptions)
+		if err != nil {
+			return err
+		}
+		comments := make([]Comment, 0)
+		err = cursor.All(ctx.UserContext(), &comments)
+		if err != nil {
+			return err
+		}
+		return sendComments(ctx, comments)
+	})
+	app.Patch("/comments/:video_id/:comment_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		comment, ok, err := getComment(ctx)
+		if !ok {
+			return err
+		}
+		if comment.UserId != userId {
+			return fiber.NewError(403, "Only the author can edit this comment")
+		}
+		var input CommentInput
+		err = ctx.BodyParser(&input)
+		if err != nil {
+			return err
+		}
+		if !validCommentText(input.Text) {
+			return fiber.NewError(400, "Comments must be between 1 and "+strconv.Itoa(maxCommentLength)+" characters")
+		}
+		if containsBlockedTerm(input.Text, detectLanguage(input.Text), viewerCountry(ctx)) {
+			return fiber.NewError(400, "Comment contains blocked words")
+		}
+
+		mentions, err := resolveMentions(input.Text, userId)
+		if err != nil {
+			return err
+		}
+
+		update := bson.D{{"$set", bson.D{{"text", strings.TrimSpace(input.Text)}, {"edited_at", time.Now()}, {"mentions", mentions}}}}
+		_, err = commentsCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", comment.Id}}, update)
+		if err != nil {
+			return err
+		}
+		// Only users who weren't already notified for this comment
+		notifyCommentMentions(comment, newMentions(comment.Mentions, mentions))
+		return nil
+	})
+	app.Delete("/comments/:video_id/:comment_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		comment, ok, err := getComment(ctx)
+		if !ok {
+			return err
+		}
+		video, err := getVideo(ctx.UserContext(), comment.VideoId)
+		if err != nil {
+			return err
+		}
+		// Creators can moderate comments on their own videos
+		if comment.UserId != userId && video.CreatorId != userId {
+			return fiber.NewError(403, "Only the author or the creator can delete this comment")
+		}
+
+		// Replies go together with the comment they reply to
+		commentIds, err := commentThread(comment.Id)
+		if err != nil {
+			return err
+		}
+		result, err := commentsCollection.DeleteMany(ctx.UserContext(), bson.D{{"_id", bson.D{{"$in", commentIds}}}})
+		if err != nil || result.DeletedCount == 0 {
+			return err
+		}
+		_, err = commentLikesCollection.DeleteMany(ctx.UserContext(), bson.D{{"comment_id", bson.D{{"$in", commentIds}}}})
+		if err != nil {
+			return err
+		}
+		if comment.ParentCommentId != 0 {
+			_, err = commentsCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", comment.ParentCommentId}}, bson.D{{"$inc", bson.D{{"replies", -1}}}})
+			if err != nil {
+				return err
+			}
+		}
+		return incrementCounter(video, "comments", -result.DeletedCount)
+	})
+	app.Get("/comments/:video_id/:comment_id/replies", func(ctx *fiber.Ctx) error {
+		_, ok, err := getViewableVideo(ctx, viewerId(ctx))
+		if !ok {
+			return err
+		}
+		comment, ok, err := getComment(ctx)
+		if !ok {
+			return err
+		}
+
+		// Replies read oldest first, continuing with ?after=
+		limit, err := pageLimit(ctx)
+		if err != nil {
+			return err
+		}
+		filter := bson.D{{"parent_comment_id", comment.Id}}
+		if after := ctx.Query("after"); after != "" {
+			afterId, err := strconv.ParseInt(after, 10, 64)
+			if err != nil {
+				return err
+			}
+			filter = append(filter, bson.E{Key: "_id", Value: bson.D{{"$gt", afterId}}})
+		}
+		cursor, err := commentsCollection.Find(ctx.UserContext(), filter, options.Find().SetSort(bson.D{{"_id", 1}}).SetLimit(limit))
+		if err != nil {
+			return err
+		}
+		replies := make([]Comment, 0)
+		err = cursor.All(ctx.UserContext(), &replies)
+		if err != nil {
+			return err
+		}
+		return sendComments(ctx, replies)
+	})
+}
+
+// Ids of the comment and every reply below it
+func commentThread(commentId int64) ([]int64, error) {
+	thread := []int64{commentId}
+	parents := []int64{commentId}
+	for len(parents) > 0 {
+		children, err := commentsCollection.Distinct(mctx, "_id", bson.D{{"parent_comment_id", bson.D{{"$in", parents}}}})
+		if err != nil {
+			return nil, err
+		}
+		parents = make([]int64, len(children))
+		for i, child := range children {
+			parents[i] = child.(int64)
+		}
+		thread = append(thread, parents...)
+	}
+	return thread, nil
+}
@@ -1,6 +1,609 @@
 package main
 
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// Settings from the config file, the environment overrides them
+	fileSettings = make(map[string]string)
+	// Every setting that was looked up, to catch misspelt ones in the file
+	knownSettings  = make(map[string]bool)
+	configProblems []string
+)
+
 type Config struct {
-	port string
-	mongoUri string
+	port          string
+	mongoUri      string
+	mongoDatabase string
+	// Node in generated ids, every instance needs its own. Below 0 leases a free one through mongo.
+	snowflakeNode int64
+	// How long shutdown waits for in-flight requests and background work
+	shutdownTimeout time.Duration
+	// Collector spans are exported to over otlp/http, tracing is disabled without one
+	otlpEndpoint string
+
+	// Fraud scoring
+	ipHashSalt       string
+	fraudWindow      time.Duration
+	fraudMaxAccounts int64
+
+	// Comma separated id=base64 key, ip hashes on events are encrypted with the active one
+	fieldEncryptionKeys  string
+	fieldEncryptionKeyId string
+
+	// Admin
+	adminToken    string
+	internalToken string
+
+	// User tokens, routes with a user id in the path are open to anyone without a secret or JWKS url
+	jwtSecret    string
+	jwksUrl      string
+	jwtIssuer    string
+	jwtUserClaim string
+
+	// Age restriction
+	minimumAge int64
+
+	// Interests
+	interestSnapshotInterval time.Duration
+	// Interests at or below the floor, or within near zero of 0, are pruned
+	interestFloor    int64
+	interestNearZero int64
+	interestMaxTags  int64
+	// Initial value for topics picked during onboarding
+	interestSeedValue int64
+	// How much commenting on a video adds to the interest in its tags
+	commentInterestWeight int64
+	// How much disliking a video removes from the interest in its tags
+	dislikeInterestWeight int64
+	// Saving is a stronger signal than liking, so this should be above 11
+	saveInterestWeight  int64
+	shareInterestWeight int64
+	// How much watching a video all the way through adds to the interest in its tags
+	fullWatchInterestWeight int64
+	// Share of the video a watch has to reach to take it off the watch later queue
+	watchLaterCompletion float64
+	// Watching a video again after this long adjusts interests again, 0 only adjusts them on the first watch
+	rewatchWindow time.Duration
+	// The feed leaves out the latest videos the user watched within the window, up to the limit
+	feedSeenWindow time.Duration
+	feedSeenLimit  int64
+	// Shares of the feed taken by interest matches, trending videos and a random sample of fresh uploads
+	feedMixInterest float64
+	feedMixTrending float64
+	feedMixFresh    float64
+	// Uploads younger than this count as fresh
+	feedFreshWindow time.Duration
+	// Progress events further apart than this start a new watch session
+	watchSessionGap time.Duration
+
+	// Tag embedding expansion
+	tagExpansion           bool
+	tagEmbeddingsFile      string
+	tagSimilarityThreshold float64
+	tagExpansionFactor     float64
+
+	// Keywords extracted from descriptions
+	keywordMaxTags        int64
+	keywordInterestFactor float64
+
+	// Notifications
+	milestoneWebhook string
+	indexingWebhook  string
+	// Asked to redo thumbnails and renditions when a video is reprocessed
+	mediaPipelineWebhook string
+	mentionWebhook       string
+	webhookAttempts      int64
+
+	// How often analytics roll-ups catch up with new events
+	rollupInterval time.Duration
+
+	// Search
+	elasticsearchUrl   string
+	elasticsearchIndex string
+
+	// Watch events on videos with at least this many views keep their stats at the sampling rate, 0 disables sampling
+	watchSamplingThreshold int64
+	watchSamplingRate      float64
+
+	// Storage
+	skynetPortal string
+	// Comma separated portals to fail over between, overrides skynetPortal
+	skynetPortals       string
+	uploadMaxBytes      int64
+	remoteUploadTimeout time.Duration
+
+	// Direct uploads to an s3 compatible bucket
+	s3Bucket      string
+	s3Region      string
+	s3Endpoint    string
+	presignExpiry time.Duration
+
+	// Like and watch events older than this are moved to cold storage, 0 disables archiving
+	eventArchiveAfter    time.Duration
+	eventArchiveInterval time.Duration
+
+	// Mongo latency above which low priority requests are shed, 0 disables admission control
+	admissionLatency      time.Duration
+	admissionQueueTimeout time.Duration
+
+	// Identical like and watch requests within this window are dropped, 0 disables deduping
+	dedupeWindow time.Duration
+
+	// How long Idempotency-Key responses are kept for retries
+	idempotencyTtl time.Duration
+	// How long a request holds its Idempotency-Key without renewing it, after which a retry takes the key over
+	idempotencyLease time.Duration
+	// Repeating a like, save or dislike, or undoing one that was never made, answers 200 instead of 409
+	duplicateInteractionNoop bool
+
+	// Likes and uploads each user can make per period, a limit of 0 disables it
+	likeRateLimit    int64
+	likeRatePeriod   time.Duration
+	uploadRateLimit  int64
+	uploadRatePeriod time.Duration
+
+	// Comma separated residency=uri, like and watch events of users with that residency are kept in that database
+	residencyMongoUris string
+
+	// Mongo commands slower than this are logged, 0 disables the slow query log
+	slowQueryThreshold time.Duration
+
+	// Refuse to start when stored documents no longer match the shared models
+	schemaCheck bool
+
+	// Injects up to the latency and fails at the error rate on mongo and storage calls, for staging only
+	chaosMode      bool
+	chaosLatency   time.Duration
+	chaosErrorRate float64
+
+	// Header the edge puts the viewer's country code in
+	regionHeader string
+
+	// Trending only includes videos past the warm-up after upload and younger than the max age
+	trendingWarmup time.Duration
+	trendingMaxAge time.Duration
+	// Likes and shares made during the warm-up count this much towards the engagement rate
+	trendingWarmupWeight float64
+
+	// Hashtags are trending by how much they grew over the window, refreshed every interval
+	trendingTagsWindow   time.Duration
+	trendingTagsInterval time.Duration
+
+	// Translation backend, translation endpoints are disabled without one
+	translationUrl    string
+	translationApiKey string
+
+	// Speech to text service for automatic captions, none are generated without one
+	captionsUrl     string
+	captionsTimeout time.Duration
+
+	// Uploads with a description spam score at or above this are held for moderation, 0 disables holding
+	spamHoldThreshold float64
+	// How often blocklists changed through other instances are picked up
+	blocklistReloadInterval time.Duration
+	// How often kill switches flipped through other instances are picked up
+	killSwitchReloadInterval time.Duration
+	// How often upload policies changed through other instances are picked up
+	uploadPolicyReloadInterval time.Duration
+
+	// Email, weekly reports aren't sent without an smtp server
+	smtpAddr     string
+	smtpUsername string
+	smtpPassword string
+	emailFrom    string
+}
+
+// Loads the config from the environment and the optional yaml file in config_file, with the environment
+// taking precedence. Exits listing every missing or invalid setting instead of stopping at the first.
+func loadConfig() *Config {
+	if path := os.Getenv("config_file"); path != "" {
+		loadConfigFile(path)
+	}
+	config := &Config{
+		port:          getEnv("port", ""),
+		mongoUri:      getEnv("mongo_uri", ""),
+		mongoDatabase: getEnv("mongo_database", "blue"),
+		snowflakeNode: getEnvInt64("snowflake_node", -1),
+
+		shutdownTimeout: getEnvDuration("shutdown_timeout", 30*time.Second),
+		otlpEndpoint:    getEnv("otlp_endpoint", ""),
+
+		ipHashSalt:       getEnv("ip_hash_salt", ""),
+		fraudWindow:      getEnvDuration("fraud_window", 10*time.Minute),
+		fraudMaxAccounts: getEnvInt64("fraud_max_accounts", 5),
+
+		fieldEncryptionKeys:  getEnv("field_encryption_keys", ""),
+		fieldEncryptionKeyId: getEnv("field_encryption_key_id", ""),
+
+		adminToken:    getEnv("admin_token", ""),
+		internalToken: getEnv("internal_token", ""),
+
+		jwtSecret:    getEnv("jwt_secret", ""),
+		jwksUrl:      getEnv("jwks_url", ""),
+		jwtIssuer:    getEnv("jwt_issuer", ""),
+		jwtUserClaim: getEnv("jwt_user_claim", "sub"),
+
+		minimumAge: getEnvInt64("minimum_age", 18),
+
+		interestSnapshotInterval: getEnvDuration("interest_snapshot_interval", 24*time.Hour),
+		interestFloor:            getEnvInt64("interest_floor", -100),
+		interestNearZero:         getEnvInt64("interest_near_zero", 0),
+		interestMaxTags:          getEnvInt64("interest_max_tags", 500),
+		interestSeedValue:        getEnvInt64("interest_seed_value", 50),
+		commentInterestWeight:    getEnvInt64("comment_interest_weight", 11),
+		dislikeInterestWeight:    getEnvInt64("dislike_interest_weight", 11),
+		saveInterestWeight:       getEnvInt64("save_interest_weight", 22),
+		shareInterestWeight:      getEnvInt64("share_interest_weight", 16),
+		fullWatchInterestWeight:  getEnvInt64("full_watch_interest_weight", 11),
+		watchLaterCompletion:     getEnvFloat64("watch_later_completion", 0.9),
+		rewatchWindow:            getEnvDuration("rewatch_window", 0),
+		watchSessionGap:          getEnvDuration("watch_session_gap", 30*time.Minute),
+		feedSeenWindow:           getEnvDuration("feed_seen_window", 30*24*time.Hour),
+		feedSeenLimit:            getEnvInt64("feed_seen_limit", 1000),
+		feedMixInterest:          getEnvFloat64("feed_mix_interest", 0.7),
+		feedMixTrending:          getEnvFloat64("feed_mix_trending", 0.2),
+		feedMixFresh:             getEnvFloat64("feed_mix_fresh", 0.1),
+		feedFreshWindow:          getEnvDuration("feed_fresh_window", 48*time.Hour),
+
+		tagExpansion:           getEnvBool("tag_expansion", false),
+		tagEmbeddingsFile:      getEnv("tag_embeddings_file", ""),
+		tagSimilarityThreshold: getEnvFloat64("tag_similarity_threshold", 0.8),
+		tagExpansionFactor:     getEnvFloat64("tag_expansion_factor", 0.25),
+
+		keywordMaxTags:        getEnvInt64("keyword_max_tags", 5),
+		keywordInterestFactor: getEnvFloat64("keyword_interest_factor", 0.5),
+
+		milestoneWebhook:     getEnv("milestone_webhook", ""),
+		indexingWebhook:      getEnv("indexing_webhook", ""),
+		mediaPipelineWebhook: getEnv("media_pipeline_webhook", ""),
+		mentionWebhook:       getEnv("mention_webhook", ""),
+		webhookAttempts:      getEnvInt64("webhook_attempts", 5),
+
+		rollupInterval: getEnvDuration("rollup_interval", time.Hour),
+
+		elasticsearchUrl:   getEnv("elasticsearch_url", ""),
+		elasticsearchIndex: getEnv("elasticsearch_index", "videos"),
+
+		watchSamplingThreshold: getEnvInt64("watch_sampling_threshold", 0),
+		watchSamplingRate:      getEnvFloat64("watch_sampling_rate", 1),
+
+		skynetPortal:        getEnv("skynet_portal", ""),
+		skynetPortals:       getEnv("skynet_portals", ""),
+		uploadMaxBytes:      getEnvInt64("upload_max_bytes", 200*1024*1024),
+		remoteUploadTimeout: getEnvDuration("remote_upload_timeout", 2*time.Minute),
+
+		s3Bucket:      getEnv("s3_bucket", ""),
+		s3Region:      getEnv("s3_region", ""),
+		s3Endpoint:    getEnv("s3_endpoint", ""),
+		presignExpiry: getEnvDuration("presign_expiry", 15*time.Minute),
+
+		eventArchiveAfter:    getEnvDuration("event_archive_after", 0),
+		eventArchiveInterval: getEnvDuration("event_archive_interval", time.Hour),
+
+		admissionLatency:      getEnvDuration("admission_latency", 0),
+		admissionQueueTimeout: getEnvDuration("admission_queue_timeout", 2*time.Second),
+
+		dedupeWindow: getEnvDuration("dedupe_window", 3*time.Second),
+
+		idempotencyTtl:           getEnvDuration("idempotency_ttl", 24*time.Hour),
+		idempotencyLease:         getEnvDuration("idempotency_lease", 30*time.Second),
+		duplicateInteractionNoop: getEnvBool("duplicate_interaction_noop", false),
+
+		likeRateLimit:    getEnvInt64("like_rate_limit", 60),
+		likeRatePeriod:   getEnvDuration("like_rate_period", time.Minute),
+		uploadRateLimit:  getEnvInt64("upload_rate_limit", 5),
+		uploadRatePeriod: getEnvDuration("upload_rate_period", time.Hour),
+
+		residencyMongoUris: getEnv("residency_mongo_uris", ""),
+
+		slowQueryThreshold: getEnvDuration("slow_query_threshold", 500*time.Millisecond),
+
+		schemaCheck: getEnvBool("schema_check", true),
+
+		chaosMode:      getEnvBool("chaos_mode", false),
+		chaosLatency:   getEnvDuration("chaos_latency", 0),
+		chaosErrorRate: getEnvFloat64("chaos_error_rate", 0),
+
+		regionHeader: getEnv("region_header", "X-Country-Code"),
+
+		trendingWarmup:       getEnvDuration("trending_warmup", time.Hour),
+		trendingMaxAge:       getEnvDuration("trending_max_age", 7*24*time.Hour),
+		trendingWarmupWeight: getEnvFloat64("trending_warmup_weight", 0.25),
+
+		trendingTagsWindow:   getEnvDuration("trending_tags_window", 24*time.Hour),
+		trendingTagsInterval: getEnvDuration("trending_tags_interval", 15*time.Minute),
+
+		translationUrl:    getEnv("translation_url", ""),
+		translationApiKey: getEnv("translation_api_key", ""),
+
+		captionsUrl:     getEnv("captions_url", ""),
+		captionsTimeout: getEnvDuration("captions_timeout", 10*time.Minute),
+
+		spamHoldThreshold:       getEnvFloat64("spam_hold_threshold", 1),
+		blocklistReloadInterval: getEnvDuration("blocklist_reload_interval", 5*time.Minute),
+
+		killSwitchReloadInterval:   getEnvDuration("kill_switch_reload_interval", 10*time.Second),
+		uploadPolicyReloadInterval: getEnvDuration("upload_policy_reload_interval", time.Minute),
+
+		smtpAddr:     getEnv("smtp_addr", ""),
+		smtpUsername: getEnv("smtp_username", ""),
+		smtpPassword: getEnv("smtp_password", ""),
+		emailFrom:    getEnv("email_from", "reports@blue.app"),
+	}
+	validateConfig(config)
+	for name := range fileSettings {
+		if !knownSettings[name] {
+			configProblem(name, "unknown setting in %s", os.Getenv("config_file"))
+		}
+	}
+	if len(configProblems) > 0 {
+		sort.Strings(configProblems)
+		log.Fatalf("Invalid configuration:\n  %s", strings.Join(configProblems, "\n  "))
+	}
+	return config
+}
+
+// Settings use the same names in the file as in the environment, lists are joined with commas
+func loadConfigFile(path string) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		configProblem("config_file", "%s", err)
+		return
+	}
+	var settings map[string]interface{}
+	err = yaml.Unmarshal(raw, &settings)
+	if err != nil {
+		configProblem("config_file", "%s", err)
+		return
+	}
+	for name, value := range settings {
+		switch value := value.(type) {
+		case nil:
+		case []interface{}:
+			values := make([]string, len(value))
+			for i, element := range value {
+				values[i] = fmt.Sprint(element)
+			}
+			fileSettings[name] = strings.Join(values, ",")
+		case map[string]interface{}:
+			configProblem(name, "expected a value or a list")
+		default:
+			fileSettings[name] = fmt.Sprint(value)
+		}
+	}
+}
+
+func configProblem(name string, format string, args ...interface{}) {
+	configProblems = append(configProblems, name+": "+fmt.Sprintf(format, args...))
+}
+
+func lookupSetting(name string) string {
+	knownSettings[name] = true
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fileSettings[name]
+}
+
+func validateConfig(config *Config) {
+	if config.port == "" {
+		configProblem("port", "required")
+	} else if _, _, err := net.SplitHostPort(config.port); err != nil {
+		configProblem("port", "expected [host]:port, got %q", config.port)
+	}
+	if config.mongoUri == "" {
+		configProblem("mongo_uri", "required")
+	} else if !strings.HasPrefix(config.mongoUri, "mongodb://") && !strings.HasPrefix(config.mongoUri, "mongodb+srv://") {
+		configProblem("mongo_uri", "expected a mongodb:// or mongodb+srv:// uri")
+	}
+	if config.mongoDatabase == "" {
+		configProblem("mongo_database", "required")
+	}
+	if config.snowflakeNode > maxNode {
+		configProblem("snowflake_node", "has to be at most %d, or negative to lease one, got %d", maxNode, config.snowflakeNode)
+	}
+
+	for name, value := range map[string]string{
+		"skynet_portal":          config.skynetPortal,
+		"jwks_url":               config.jwksUrl,
+		"milestone_webhook":      config.milestoneWebhook,
+		"indexing_webhook":       config.indexingWebhook,
+		"media_pipeline_webhook": config.mediaPipelineWebhook,
+		"mention_webhook":        config.mentionWebhook,
+		"elasticsearch_url":      config.elasticsearchUrl,
+		"s3_endpoint":            config.s3Endpoint,
+		"translation_url":        config.translationUrl,
+		"captions_url":           config.captionsUrl,
+		"otlp_endpoint":          config.otlpEndpoint,
+	} {
+		if value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			configProblem(name, "expected an http or https url, got %q", value)
+		}
+	}
+	for _, portal := range strings.Split(config.skynetPortals, ",") {
+		if portal = strings.TrimSpace(portal); portal == "" {
+			continue
+		}
+		if parsed, err := url.Parse(portal); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			configProblem("skynet_portals", "expected http or https urls, got %q", portal)
+		}
+	}
+	if config.s3Bucket != "" && config.s3Region == "" {
+		configProblem("s3_region", "required when s3_bucket is set")
+	}
+
+	// Intervals and timeouts, a ticker panics on anything but a positive interval
+	for name, value := range map[string]time.Duration{
+		"shutdown_timeout":              config.shutdownTimeout,
+		"fraud_window":                  config.fraudWindow,
+		"interest_snapshot_interval":    config.interestSnapshotInterval,
+		"rollup_interval":               config.rollupInterval,
+		"watch_session_gap":             config.watchSessionGap,
+		"feed_seen_window":              config.feedSeenWindow,
+		"feed_fresh_window":             config.feedFreshWindow,
+		"remote_upload_timeout":         config.remoteUploadTimeout,
+		"presign_expiry":                config.presignExpiry,
+		"event_archive_interval":        config.eventArchiveInterval,
+		"admission_queue_timeout":       config.admissionQueueTimeout,
+		"idempotency_ttl":               config.idempotencyTtl,
+		"idempotency_lease":             config.idempotencyLease,
+		"like_rate_period":              config.likeRatePeriod,
+		"upload_rate_period":            config.uploadRatePeriod,
+		"trending_tags_window":          config.trendingTagsWindow,
+		"trending_tags_interval":        config.trendingTagsInterval,
+		"trending_max_age":              config.trendingMaxAge,
+		"captions_timeout":              config.captionsTimeout,
+		"blocklist_reload_interval":     config.blocklistReloadInterval,
+		"kill_switch_reload_interval":   config.killSwitchReloadInterval,
+		"upload_policy_reload_interval": config.uploadPolicyReloadInterval,
+	} {
+		if value <= 0 {
+			configProblem(name, "has to be positive, got %s", value)
+		}
+	}
+	// Zero turns these off
+	for name, value := range map[string]time.Duration{
+		"rewatch_window":       config.rewatchWindow,
+		"event_archive_after":  config.eventArchiveAfter,
+		"admission_latency":    config.admissionLatency,
+		"dedupe_window":        config.dedupeWindow,
+		"slow_query_threshold": config.slowQueryThreshold,
+		"chaos_latency":        config.chaosLatency,
+		"trending_warmup":      config.trendingWarmup,
+	} {
+		if value < 0 {
+			configProblem(name, "can't be negative, got %s", value)
+		}
+	}
+
+	// Weights and limits
+	for name, value := range map[string]int64{
+		"fraud_max_accounts": config.fraudMaxAccounts,
+		"interest_max_tags":  config.interestMaxTags,
+		"upload_max_bytes":   config.uploadMaxBytes,
+		"webhook_attempts":   config.webhookAttempts,
+		"feed_seen_limit":    config.feedSeenLimit,
+	} {
+		if value <= 0 {
+			configProblem(name, "has to be positive, got %d", value)
+		}
+	}
+	for name, value := range map[string]int64{
+		"minimum_age":                config.minimumAge,
+		"interest_near_zero":         config.interestNearZero,
+		"interest_seed_value":        config.interestSeedValue,
+		"comment_interest_weight":    config.commentInterestWeight,
+		"dislike_interest_weight":    config.dislikeInterestWeight,
+		"save_interest_weight":       config.saveInterestWeight,
+		"share_interest_weight":      config.shareInterestWeight,
+		"full_watch_interest_weight": config.fullWatchInterestWeight,
+		"keyword_max_tags":           config.keywordMaxTags,
+		"watch_sampling_threshold":   config.watchSamplingThreshold,
+		"like_rate_limit":            config.likeRateLimit,
+		"upload_rate_limit":          config.uploadRateLimit,
+	} {
+		if value < 0 {
+			configProblem(name, "can't be negative, got %d", value)
+		}
+	}
+	for name, value := range map[string]float64{
+		"tag_similarity_threshold": config.tagSimilarityThreshold,
+		"tag_expansion_factor":     config.tagExpansionFactor,
+		"keyword_interest_factor":  config.keywordInterestFactor,
+		"chaos_error_rate":         config.chaosErrorRate,
+		"feed_mix_interest":        config.feedMixInterest,
+		"feed_mix_trending":        config.feedMixTrending,
+		"feed_mix_fresh":           config.feedMixFresh,
+		"trending_warmup_weight":   config.trendingWarmupWeight,
+		"watch_later_completion":   config.watchLaterCompletion,
+	} {
+		if value < 0 || value > 1 {
+			configProblem(name, "has to be between 0 and 1, got %g", value)
+		}
+	}
+	if config.watchSamplingRate <= 0 || config.watchSamplingRate > 1 {
+		configProblem("watch_sampling_rate", "has to be above 0 and at most 1, got %g", config.watchSamplingRate)
+	}
+	if config.feedMixInterest+config.feedMixTrending+config.feedMixFresh <= 0 {
+		configProblem("feed_mix_interest", "at least one of the feed mix shares has to be above 0")
+	}
+	if config.spamHoldThreshold < 0 {
+		configProblem("spam_hold_threshold", "can't be negative, got %g", config.spamHoldThreshold)
+	}
+}
+
+func getEnv(name string, fallback string) string {
+	value := lookupSetting(name)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func getEnvInt64(name string, fallback int64) int64 {
+	raw := lookupSetting(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		configProblem(name, "expected a whole number, got %q", raw)
+		return fallback
+	}
+	return value
+}
+
+func getEnvDuration(name string, fallback time.Duration) time.Duration {
+	raw := lookupSetting(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		configProblem(name, "expected a duration such as 30s or 5m, got %q", raw)
+		return fallback
+	}
+	return value
+}
+
+func getEnvFloat64(name string, fallback float64) float64 {
+	raw := lookupSetting(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		configProblem(name, "expected a number, got %q", raw)
+		return fallback
+	}
+	return value
+}
+
+func getEnvBool(name string, fallback bool) bool {
+	raw := lookupSetting(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		configProblem(name, "expected true or false, got %q", raw)
+		return fallback
+	}
+	return value
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type VideoCounts struct {
+	Likes           int64 `json:"likes"`
+	Views           int64 `json:"views"`
+	Comments        int64 `json:"comments"`
+	Shares          int64 `json:"shares"`
+	DistinctViewers int64 `json:"distinct_viewers"`
+}
+
+func getCounts(ctx *fiber.Ctx) error {
+	video, ok, err := getViewableVideo(ctx, viewerId(ctx))
+	if !ok {
+		return err
+	}
+	distinctViewers, err := estimateDistinctViewers(video.Id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(VideoCounts{
+		Likes:           video.Likes,
+		Views:           video.Views,
+		Comments:        video.Comments,
+		Shares:          video.Shares,
+		DistinctViewers: distinctViewers,
+	})
+}
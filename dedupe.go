@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Requests seen within the dedupe window, keyed by method and path
+var (
+	recentRequests     = make(map[string]time.Time)
+	recentRequestsLock sync.Mutex
+)
+
+func startRequestDedupe() {
+	if config.dedupeWindow == 0 {
+		return
+	}
+	every(config.dedupeWindow, func() {
+		cutoff := time.Now().Add(-config.dedupeWindow)
+		recentRequestsLock.Lock()
+		for key, seen := range recentRequests {
+			if seen.Before(cutoff) {
+				delete(recentRequests, key)
+			}
+		}
+		recentRequestsLock.Unlock()
+	})
+}
+
+// Absorbs double taps and client retries, the user and video are both part of the path. The key is held while the
+// request is in flight so concurrent duplicates are caught too, and only kept when the handler succeeded so a
+// retry of a failed request goes through.
+func dedupe(ctx *fiber.Ctx) error {
+	if config.dedupeWindow == 0 {
+		return ctx.Next()
+	}
+	key := ctx.Method() + " " + ctx.Path()
+	now := time.Now()
+
+	recentRequestsLock.Lock()
+	seen, exists := recentRequests[key]
+	duplicate := exists && now.Sub(seen) < config.dedupeWindow
+	if !duplicate {
+		recentRequests[key] = now
+	}
+	recentRequestsLock.Unlock()
+
+	if duplicate {
+		return duplicateInteraction(ctx, "duplicate_request", "Duplicate request")
+	}
+
+	err := ctx.Next()
+	if err != nil || ctx.Response().StatusCode() >= 400 {
+		recentRequestsLock.Lock()
+		if recentRequests[key] == now {
+			delete(recentRequests, key)
+		}
+		recentRequestsLock.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DislikeEvent struct {
+	VideoId int64     `bson:"video_id" json:"video_id"`
+	UserId  int64     `bson:"user_id" json:"user_id"`
+	Time    time.Time `bson:"time" json:"time"`
+}
+
+func hasDisliked(userId int64, videoId int64) bool {
+	filter := bson.D{{"user_id", userId}, {"video_id", videoId}}
+	var limit int64 = 1
+	documentCount, err := dislikedVideosCollection.CountDocuments(mctx, filter, &options.CountOptions{
+		Limit: &limit,
+	})
+	if err != nil {
+		return true
+	}
+	return documentCount == int64(1)
+}
+
+func dislikeVideo(user User, video Video) error {
+	_, err := dislikedVideosCollection.InsertOne(mctx, DislikeEvent{
+		VideoId: video.Id,
+		UserId:  user.Id,
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	adjustInterests(user, video, -config.dislikeInterestWeight)
+	return nil
+}
+
+func postDislike(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	if hasDisliked(userId, videoId) {
+		return duplicateInteraction(ctx, "already_disliked", "User has already disliked this post")
+	}
+
+	user, err := getUser(ctx.UserContext(), userId)
+	if err != nil {
+		return err
+	}
+	video, ok, err := getViewableVideo(ctx, userId)
+	if !ok {
+		return err
+	}
+
+	return dislikeVideo(user, video)
+}
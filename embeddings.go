@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"sort"
+)
+
+const maxSimilarTags = 5
+
+type similarTag struct {
+	Tag        string
+	Similarity float64
+}
+
+// Most similar tags for every tag with an embedding, only loaded when expansion is enabled
+var similarTags map[string][]similarTag
+
+func cosineSimilarity(a []float64, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Loads tag embeddings from a json file of tag to vector and precomputes the neighbours of every tag
+func loadTagEmbeddings() {
+	if !config.tagExpansion {
+		return
+	}
+	file, err := os.Open(config.tagEmbeddingsFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	var embeddings map[string][]float64
+	err = json.NewDecoder(file).Decode(&embeddings)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	similarTags = make(map[string][]similarTag)
+	for tag, embedding := range embeddings {
+		neighbours := make([]similarTag, 0)
+		for otherTag, otherEmbedding := range embeddings {
+			if otherTag == tag {
+				continue
+			}
+			similarity := cosineSimilarity(embedding, otherEmbedding)
+			if similarity >= config.tagSimilarityThreshold {
+				neighbours = append(neighbours, similarTag{Tag: otherTag, Similarity: similarity})
+			}
+		}
+		sort.Slice(neighbours, func(i, j int) bool {
+			return neighbours[i].Similarity > neighbours[j].Similarity
+		})
+		if len(neighbours) > maxSimilarTags {
+			neighbours = neighbours[:maxSimilarTags]
+		}
+		similarTags[tag] = neighbours
+	}
+	log.Printf("Loaded embeddings for %d tags", len(embeddings))
+}
+
+// Spreads a smaller part of an interest change to tags similar to the ones being changed
+func expandInterests(interests map[string]int64, delta int64) {
+	if similarTags == nil {
+		return
+	}
+	tags := make([]string, 0, len(interests))
+	for tag := range interests {
+		tags = append(tags, tag)
+	}
+	for _, tag := range tags {
+		for _, similar := range similarTags[tag] {
+			if _, exists := interests[similar.Tag]; exists {
+				continue
+			}
+			expandedDelta := int64(math.Round(float64(delta) * similar.Similarity * config.tagExpansionFactor))
+			if expandedDelta == 0 {
+				continue
+			}
+			interests[similar.Tag] = expandedDelta
+		}
+	}
+}
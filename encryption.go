@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Encrypted values look like enc:<key id>:<base64 nonce and ciphertext>
+const encryptedPrefix = "enc:"
+
+const reencryptBatchSize = 1000
+
+var errUnknownFieldKey = errors.New("encrypted with an unknown key")
+
+type fieldKey struct {
+	aead cipher.AEAD
+	// Separate key for deriving nonces, so the encryption key is never used for anything else
+	nonceKey []byte
+}
+
+var fieldKeys = make(map[string]fieldKey)
+
+// Loads field_encryption_keys, a comma separated list of id=base64 32 byte key, the active key encrypts new values
+// and the others are kept to decrypt values written before a rotation
+func initFieldEncryption() {
+	if config.fieldEncryptionKeys == "" {
+		return
+	}
+	for _, entry := range strings.Split(config.fieldEncryptionKeys, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			log.Fatalf("Invalid field encryption key %s, expected id=key", parts[0])
+		}
+		secret, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil || len(secret) != 32 {
+			log.Fatalf("Field encryption key %s must be 32 bytes of base64", parts[0])
+		}
+		block, err := aes.NewCipher(secret)
+		if err != nil {
+			log.Fatal(err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			log.Fatal(err)
+		}
+		nonceKey := sha256.Sum256(append([]byte("nonce:"), secret...))
+		fieldKeys[parts[0]] = fieldKey{aead: aead, nonceKey: nonceKey[:]}
+	}
+	if _, exists := fieldKeys[config.fieldEncryptionKeyId]; !exists {
+		log.Fatalf("Active field encryption key %s isn't configured", config.fieldEncryptionKeyId)
+	}
+}
+
+// Encrypts with the active key. The nonce is derived from the value, so equal values encrypt the same
+// and can still be grouped and matched, which fraud scoring relies on.
+func encryptField(value string) string {
+	key, exists := fieldKeys[config.fieldEncryptionKeyId]
+	if value == "" || !exists {
+		return value
+	}
+	mac := hmac.New(sha256.New, key.nonceKey)
+	mac.Write([]byte(value))
+	nonce := mac.Sum(nil)[:key.aead.NonceSize()]
+	sealed := key.aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + config.fieldEncryptionKeyId + ":" + base64.RawStdEncoding.EncodeToString(sealed)
+}
+
+// Values written before encryption was turned on are returned as they are
+func decryptField(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", errUnknownFieldKey
+	}
+	key, exists := fieldKeys[parts[0]]
+	if !exists {
+		return "", errUnknownFieldKey
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	nonceSize := key.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errUnknownFieldKey
+	}
+	plaintext, err := key.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Re-encrypts stored ip hashes with the active key after a rotation, in the background
+func reencryptFields(ctx *fiber.Ctx) error {
+	if len(fieldKeys) == 0 {
+		return fiber.NewError(409, "Field encryption isn't configured")
+	}
+	background(func() {
+		for _, residency := range residencies() {
+			_, _, watched, watchedArchive := residentEvents(residency)
+			for _, collection := range []*mongo.Collection{watched, watchedArchive} {
+				updated, err := reencryptIpHashes(collection)
+				if err != nil {
+					log.Printf("Re-encrypting %s in the %s database stopped after %d events: %s", collection.Name(), databaseLabel(residency), updated, err)
+					if err == errShuttingDown {
+						return
+					}
+					continue
+				}
+				log.Printf("Re-encrypted %d events in %s in the %s database", updated, collection.Name(), databaseLabel(residency))
+			}
+		}
+	})
+	return ctx.SendStatus(202)
+}
+
+func reencryptIpHashes(collection *mongo.Collection) (int64, error) {
+	current := primitive.Regex{Pattern: "^" + encryptedPrefix + config.fieldEncryptionKeyId + ":"}
+	filter := bson.D{{"ip_hash", bson.D{{"$exists", true}, {"$not", current}}}}
+	cursor, err := collection.Find(mctx, filter, options.Find().SetProjection(bson.D{{"ip_hash", 1}}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(mctx)
+
+	var updated int64
+	writes := make([]mongo.WriteModel, 0, reencryptBatchSize)
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		result, err := collection.BulkWrite(mctx, writes)
+		if err != nil {
+			return err
+		}
+		updated += result.ModifiedCount
+		writes = writes[:0]
+		return nil
+	}
+	for cursor.Next(mctx) {
+		var event struct {
+			Id     interface{} `bson:"_id"`
+			IpHash string      `bson:"ip_hash"`
+		}
+		err = cursor.Decode(&event)
+		if err != nil {
+			return updated, err
+		}
+		ipHash, err := decryptField(event.IpHash)
+		if err != nil {
+			return updated, err
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{"_id", event.Id}}).
+			SetUpdate(bson.D{{"$set", bson.D{{"ip_hash", encryptField(ipHash)}}}}))
+		if len(writes) == reencryptBatchSize {
+			if shuttingDown() {
+				return updated, errShuttingDown
+			}
+			err = flush()
+			if err != nil {
+				return updated, err
+			}
+		}
+	}
+	if cursor.Err() != nil {
+		return updated, cursor.Err()
+	}
+	return updated, flush()
+}
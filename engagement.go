@@ -0,0 +1,48 @@
+package main
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Likes and shares per distinct viewer, for use in an update pipeline, so rewatches don't dilute the rate.
+// Videos without a viewer estimate yet fall back to their views. Likes and shares made during the trending warm-up
+// only count at trending_warmup_weight, so a burst at publish time can't carry a video into trending.
+func engagementRateExpression() bson.D {
+	warmup := bson.D{{"$ifNull", bson.A{"$warmup_engagements", 0}}}
+	engagements := bson.D{{"$max", bson.A{0, bson.D{{"$subtract", bson.A{
+		bson.D{{"$add", bson.A{
+			bson.D{{"$ifNull", bson.A{"$likes", 0}}},
+			bson.D{{"$ifNull", bson.A{"$shares", 0}}},
+		}}},
+		bson.D{{"$multiply", bson.A{warmup, 1 - config.trendingWarmupWeight}}},
+	}}}}}}
+	viewers := bson.D{{"$ifNull", bson.A{"$distinct_viewers", "$views", 0}}}
+	return bson.D{{"engagement_rate", bson.D{{"$cond", bson.A{
+		bson.D{{"$gt", bson.A{viewers, 0}}},
+		bson.D{{"$divide", bson.A{engagements, viewers}}},
+		0,
+	}}}}}
+}
+
+// Stores the estimate from the video's viewer sketch and recomputes the engagement rate with it
+func updateDistinctViewers(videoId int64) error {
+	distinctViewers, err := estimateDistinctViewers(videoId)
+	if err != nil {
+		return err
+	}
+	_, err = videosCollection.UpdateOne(mctx, bson.D{{"_id", videoId}}, mongo.Pipeline{
+		{{"$set", bson.D{{"distinct_viewers", distinctViewers}}}},
+		{{"$set", engagementRateExpression()}},
+	})
+	return err
+}
+
+// Counts likes and shares made while the video is still warming up, for use in an update pipeline
+func warmupEngagementExpression(amount int64) bson.D {
+	inWarmup := bson.D{{"$lt", bson.A{"$$NOW", "$trending_eligible_at"}}}
+	return bson.D{{"warmup_engagements", bson.D{{"$add", bson.A{
+		bson.D{{"$ifNull", bson.A{"$warmup_engagements", 0}}},
+		bson.D{{"$cond", bson.A{inWarmup, amount, 0}}},
+	}}}}}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Body of every error a handler returns
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestId string `json:"request_id"`
+}
+
+// Errors from validating input, the message is safe to show to clients
+var badRequestErrors = []error{
+	errInvalidSort,
+	errInvalidLocation,
+	errInvalidSourceVideo,
+	errInvalidSound,
+	errDescriptionTooLong,
+	errNotAVideo,
+	errChecksumMismatch,
+	errInvalidRemoteUrl,
+	errForbiddenAddress,
+}
+
+// Codes of errors handlers return with fiber.NewError, by status
+var statusCodes = map[int]string{
+	400: "bad_request",
+	401: "unauthorized",
+	403: "forbidden",
+	404: "not_found",
+	405: "method_not_allowed",
+	409: "conflict",
+	410: "gone",
+	413: "too_large",
+	422: "unprocessable",
+	429: "too_many_requests",
+	451: "unavailable_for_legal_reasons",
+	501: "not_implemented",
+	503: "unavailable",
+}
+
+func classifyError(err error) (int, string, string) {
+	var fiberError *fiber.Error
+	if errors.As(err, &fiberError) {
+		code, exists := statusCodes[fiberError.Code]
+		if !exists {
+			code = "http_error"
+		}
+		return fiberError.Code, code, fiberError.Message
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 404, "not_found", "Not found"
+	}
+	for _, badRequest := range badRequestErrors {
+		if errors.Is(err, badRequest) {
+			return 400, "bad_request", err.Error()
+		}
+	}
+	var violation *PolicyViolation
+	if errors.As(err, &violation) {
+		return 400, "policy_violation", violation.Message
+	}
+	if errors.Is(err, errUploadTooLarge) || errors.Is(err, errRemoteTooLarge) {
+		return 413, "too_large", err.Error()
+	}
+	if errors.Is(err, errNoPortals) {
+		return 503, "storage_unavailable", "Storage is unavailable"
+	}
+
+	// Malformed ids, numbers, times and json in the request
+	var numError *strconv.NumError
+	var timeError *time.ParseError
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &numError):
+		return 400, "invalid_number", "Invalid number " + strconv.Quote(numError.Num)
+	case errors.As(err, &timeError):
+		return 400, "invalid_time", "Invalid time " + strconv.Quote(timeError.Value)
+	case errors.As(err, &syntaxError), errors.As(err, &typeError):
+		return 400, "invalid_body", "Invalid request body"
+	}
+	return 500, "internal_error", "Internal server error"
+}
+
+// Renders errors returned by handlers as json, internal errors are logged instead of shown. Errors made with
+// fiber.NewError are responses the handler chose, so they aren't logged.
+func handleError(ctx *fiber.Ctx, err error) error {
+	status, code, message := classifyError(err)
+	requestId, _ := ctx.Locals("requestid").(string)
+	var fiberError *fiber.Error
+	if status >= 500 && !errors.As(err, &fiberError) {
+		log.Printf("%s %s failed: request_id=%s error=%s", ctx.Method(), ctx.Path(), requestId, err)
+	}
+	return ctx.Status(status).JSON(ErrorResponse{Code: code, Message: message, RequestId: requestId})
+}
+
+// Repeating an interaction is a conflict, or a no-op for clients that retry blindly
+func duplicateInteraction(ctx *fiber.Ctx, code string, message string) error {
+	if config.duplicateInteractionNoop {
+		return ctx.SendStatus(200)
+	}
+	requestId, _ := ctx.Locals("requestid").(string)
+	return ctx.Status(409).JSON(ErrorResponse{Code: code, Message: message, RequestId: requestId})
+}
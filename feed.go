@@ -0,0 +1,242 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Candidates are videos tagged with one of the user's strongest interests
+	feedInterestTags = 50
+	// Ids a client can send as already seen
+	maxFeedSeen = 500
+)
+
+type ScoredVideo struct {
+	Video `bson:",inline"`
+	Score float64 `bson:"score" json:"score"`
+	// Which part of the feed mix the video came from
+	Source string `bson:"-" json:"source"`
+}
+
+// The user's most positive interests, strongest first
+func topInterests(user User, limit int) ([]string, []int64) {
+	tags := make([]string, 0, len(user.Interests))
+	for tag, value := range user.Interests {
+		if value > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return user.Interests[tags[i]] > user.Interests[tags[j]]
+	})
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	values := make([]int64, len(tags))
+	for i, tag := range tags {
+		values[i] = user.Interests[tag]
+	}
+	return tags, values
+}
+
+// Lets the feed find a user's latest watches without scanning their whole history
+func createFeedIndex() {
+	for _, residency := range residencies() {
+		_, err := residentCollection(residency, watchedVideosCollection).Indexes().CreateOne(mctx, mongo.IndexModel{
+			Keys: bson.D{{"user_id", 1}, {"time", -1}},
+		})
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// Videos the user watched within feed_seen_window, newest first and at most feed_seen_limit of them.
+// The archive is only searched when events can be archived while still inside the window. Watches stored before
+// events had a time are dated by their ObjectId.
+func recentlyWatchedVideoIds(userId int64) ([]int64, error) {
+	residency, err := userResidency(mctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	_, _, watchedCollection, watchedArchive := residentEvents(residency)
+	since := time.Now().Add(-config.feedSeenWindow)
+	filter := bson.D{{"user_id", userId}, {"$or", bson.A{
+		bson.D{{"time", bson.D{{"$gte", since}}}},
+		bson.D{{"time", bson.D{{"$exists", false}}}, {"_id", bson.D{{"$gte", primitive.NewObjectIDFromTimestamp(since)}}}},
+	}}}
+	findOptions := options.Find().
+		SetSort(bson.D{{"time", -1}, {"_id", -1}}).
+		SetLimit(config.feedSeenLimit).
+		SetProjection(bson.D{{"video_id", 1}})
+
+	collections := []*mongo.Collection{watchedCollection}
+	if config.eventArchiveAfter > 0 && config.eventArchiveAfter < config.feedSeenWindow {
+		collections = append(collections, watchedArchive)
+	}
+	watched := make([]int64, 0)
+	for _, collection := range collections {
+		cursor, err := collection.Find(mctx, filter, findOptions)
+		if err != nil {
+			return nil, err
+		}
+		var events []WatchEvent
+		err = cursor.All(mctx, &events)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			watched = append(watched, event.VideoId)
+		}
+	}
+	return watched, nil
+}
+
+// The ids in ?seen=, comma separated, which the client has already shown the user
+func clientSeenVideoIds(ctx *fiber.Ctx) ([]int64, error) {
+	raw := ctx.Query("seen")
+	if raw == "" {
+		return nil, nil
+	}
+	parts := strings.Split(raw, ",")
+	if len(parts) > maxFeedSeen {
+		parts = parts[len(parts)-maxFeedSeen:]
+	}
+	seen := make([]int64, 0, len(parts))
+	for _, part := range parts {
+		videoId, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		seen = append(seen, videoId)
+	}
+	return seen, nil
+}
+
+// One $nin list without duplicates, rewatches and ids the client also sends would otherwise repeat
+func seenExclusion(lists ...[]int64) bson.A {
+	seen := make(map[int64]bool)
+	excluded := make(bson.A, 0)
+	for _, list := range lists {
+		for _, videoId := range list {
+			if !seen[videoId] {
+				seen[videoId] = true
+				excluded = append(excluded, videoId)
+			}
+		}
+	}
+	return excluded
+}
+
+// Everything a viewer shouldn't see in listings, shared by the feed and anything ranked for a user
+func viewerFilter(ctx *fiber.Ctx, user User) (bson.D, error) {
+	filter := bson.D{
+		{"public", true},
+		{"taken_down", bson.D{{"$ne", true}}},
+	}
+	if !canViewAgeRestricted(user) {
+		filter = append(filter, bson.E{Key: "age_restricted", Value: bson.D{{"$ne", true}}})
+	}
+	filter = append(filter, contentWarningFilter(user)...)
+	filter = append(filter, languageFilter(user)...)
+	filter = append(filter, regionFilter(viewerCountry(ctx))...)
+	blocks, err := blockFilter(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	return append(filter, blocks...), nil
+}
+
+// Mixes videos matching the user's interests with trending and fresh ones, leaving out recently watched videos
+// and any the client lists in ?seen=. Clients page by sending what they showed in ?seen=, the sources are ranked
+// and sampled differently so there's no offset that would pick up where a page left off.
+func getFeed(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	limit, err := pageLimit(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := getUser(ctx.UserContext(), userId)
+	if err != nil {
+		return err
+	}
+	filter, err := viewerFilter(ctx, user)
+	if err != nil {
+		return err
+	}
+	watched, err := recentlyWatchedVideoIds(userId)
+	if err != nil {
+		return err
+	}
+	seen, err := clientSeenVideoIds(ctx)
+	if err != nil {
+		return err
+	}
+	excluded := seenExclusion(watched, seen)
+
+	videos, err := mixFeed(user, filter, excluded, limit)
+	if err != nil {
+		return err
+	}
+	creatorIds := make([]int64, len(videos))
+	for i, video := range videos {
+		creatorIds[i] = video.CreatorId
+	}
+	verified, err := verifiedUsers(creatorIds)
+	if err != nil {
+		return err
+	}
+	for i := range videos {
+		videos[i].CreatorVerified = verified[videos[i].CreatorId]
+	}
+	return ctx.JSON(videos)
+}
+
+// Videos tagged with the user's interests, ranked by the sum of the user's interest in each of their tags
+func interestCandidates(user User, filter bson.D, limit int64) ([]ScoredVideo, error) {
+	tags, values := topInterests(user, feedInterestTags)
+	if len(tags) == 0 || limit <= 0 {
+		return nil, nil
+	}
+	filter = append(filter, bson.E{Key: "tags", Value: bson.D{{"$in", tags}}})
+
+	score := bson.D{{"$sum", bson.D{{"$map", bson.D{
+		{"input", bson.D{{"$ifNull", bson.A{"$tags", bson.A{}}}}},
+		{"as", "tag"},
+		{"in", bson.D{{"$let", bson.D{
+			{"vars", bson.D{{"index", bson.D{{"$indexOfArray", bson.A{tags, "$$tag"}}}}}},
+			{"in", bson.D{{"$cond", bson.A{
+				bson.D{{"$gte", bson.A{"$$index", 0}}},
+				bson.D{{"$arrayElemAt", bson.A{values, "$$index"}}},
+				0,
+			}}}},
+		}}}},
+	}}}}}
+	pipeline := mongo.Pipeline{
+		{{"$match", filter}},
+		{{"$addFields", bson.D{{"score", score}}}},
+		{{"$sort", bson.D{{"score", -1}, {"engagement_rate", -1}, {"_id", -1}}}},
+		{{"$limit", limit}},
+	}
+	cursor, err := videosCollection.Aggregate(mctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	videos := make([]ScoredVideo, 0)
+	err = cursor.All(mctx, &videos)
+	return videos, err
+}
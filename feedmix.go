@@ -0,0 +1,168 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	feedSourceInterest = "interest"
+	feedSourceTrending = "trending"
+	feedSourceFresh    = "fresh"
+)
+
+type feedSource struct {
+	name  string
+	share float64
+	// Fetches up to limit videos matching the filter, which leaves out the videos already seen or picked
+	fetch func(user User, filter bson.D, limit int64) ([]ScoredVideo, error)
+}
+
+// In the order shortfalls are filled in, interests first
+func feedSources() []feedSource {
+	return []feedSource{
+		{feedSourceInterest, config.feedMixInterest, interestCandidates},
+		{feedSourceTrending, config.feedMixTrending, trendingCandidates},
+		{feedSourceFresh, config.feedMixFresh, freshCandidates},
+	}
+}
+
+// Splits the page between the sources by their share, handing leftover places to the largest remainders
+func feedQuotas(sources []feedSource, limit int64) []int64 {
+	total := 0.0
+	for _, source := range sources {
+		total += source.share
+	}
+	quotas := make([]int64, len(sources))
+	remainders := make([]float64, len(sources))
+	assigned := int64(0)
+	for i, source := range sources {
+		exact := float64(limit) * source.share / total
+		quotas[i] = int64(math.Floor(exact))
+		remainders[i] = exact - float64(quotas[i])
+		assigned += quotas[i]
+	}
+	order := make([]int, len(sources))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; assigned < limit; i++ {
+		quotas[order[i%len(order)]]++
+		assigned++
+	}
+	return quotas
+}
+
+// Fills each source's part of the page, then tops up from the sources in order when one runs short,
+// so users without interests still get trending and fresh videos
+func mixFeed(user User, filter bson.D, excluded bson.A, limit int64) ([]ScoredVideo, error) {
+	sources := feedSources()
+	quotas := feedQuotas(sources, limit)
+	picked := make([][]ScoredVideo, len(sources))
+	pickedCount := int64(0)
+
+	fetch := func(i int, count int64) error {
+		sourceFilter := append(append(bson.D{}, filter...), bson.E{Key: "_id", Value: bson.D{{"$nin", excluded}}})
+		videos, err := sources[i].fetch(user, sourceFilter, count)
+		if err != nil {
+			return err
+		}
+		for _, video := range videos {
+			video.Source = sources[i].name
+			picked[i] = append(picked[i], video)
+			excluded = append(excluded, video.Id)
+		}
+		pickedCount += int64(len(videos))
+		return nil
+	}
+	for i := range sources {
+		if quotas[i] == 0 {
+			continue
+		}
+		err := fetch(i, quotas[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range sources {
+		if pickedCount >= limit {
+			break
+		}
+		err := fetch(i, limit-pickedCount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return interleaveFeed(picked), nil
+}
+
+// Spreads every source's videos evenly through the page, keeping each source's own order
+func interleaveFeed(picked [][]ScoredVideo) []ScoredVideo {
+	type placed struct {
+		video    ScoredVideo
+		position float64
+	}
+	all := make([]placed, 0)
+	for _, videos := range picked {
+		for i, video := range videos {
+			all = append(all, placed{video, float64(i+1) / float64(len(videos)+1)})
+		}
+	}
+	sort.SliceStable(all, func(a, b int) bool {
+		return all[a].position < all[b].position
+	})
+	videos := make([]ScoredVideo, len(all))
+	for i, entry := range all {
+		videos[i] = entry.video
+	}
+	return videos
+}
+
+// Videos currently eligible for trending, by engagement
+func trendingCandidates(_ User, filter bson.D, limit int64) ([]ScoredVideo, error) {
+	now := time.Now()
+	filter = append(filter, bson.E{Key: "trending_eligible_at", Value: bson.D{{"$lte", now}, {"$gte", now.Add(-config.trendingMaxAge)}}})
+	findOptions := options.Find().SetSort(bson.D{{"engagement_rate", -1}, {"_id", -1}}).SetLimit(limit)
+	cursor, err := videosCollection.Find(mctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	videos := make([]ScoredVideo, 0)
+	err = cursor.All(mctx, &videos)
+	if err != nil {
+		return nil, err
+	}
+	for i := range videos {
+		videos[i].Score = videos[i].EngagementRate
+	}
+	return videos, nil
+}
+
+// A random sample of videos uploaded within feed_fresh_window, so new videos and creators get seen before
+// they have the engagement to trend. Ids are snowflakes, so the window is a range on _id.
+func freshCandidates(_ User, filter bson.D, limit int64) ([]ScoredVideo, error) {
+	since := time.Now().Add(-config.feedFreshWindow).UnixNano()/int64(time.Millisecond) - snowflake.Epoch
+	minId := since << (snowflake.NodeBits + snowflake.StepBits)
+	// The filter already has an _id condition for the videos to leave out
+	filter = append(filter, bson.E{Key: "$and", Value: bson.A{bson.D{{"_id", bson.D{{"$gte", minId}}}}}})
+	pipeline := mongo.Pipeline{
+		{{"$match", filter}},
+		{{"$sample", bson.D{{"size", limit}}}},
+	}
+	cursor, err := videosCollection.Aggregate(mctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	videos := make([]ScoredVideo, 0)
+	err = cursor.All(mctx, &videos)
+	return videos, err
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Stored encrypted when field encryption is configured
+func hashIp(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(config.ipHashSalt + ip))
+	return encryptField(hex.EncodeToString(sum[:]))
+}
+
+func startFraudScoring() {
+	for _, residency := range residencies() {
+		_, err := residentCollection(residency, watchedVideosCollection).Indexes().CreateOne(mctx, mongo.IndexModel{
+			Keys: bson.D{{"ip_hash", 1}, {"time", 1}},
+		})
+		if err != nil {
+			log.Print(err)
+		}
+	}
+
+	every(config.fraudWindow, func() {
+		err := scoreWatchFraud(time.Now().Add(-config.fraudWindow))
+		if err != nil {
+			log.Print(err)
+		}
+	})
+}
+
+// Finds ips that many different accounts watched from since the given time. Accounts resident in different regions
+// can share an ip, so they're counted over every database.
+func findFraudulentIps(since time.Time) ([]string, error) {
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.D{{"ip_hash", bson.D{{"$exists", true}}}, {"time", bson.D{{"$gte", since}}}}}},
+		{{"$group", bson.D{{"_id", "$ip_hash"}, {"users", bson.D{{"$addToSet", "$user_id"}}}}}},
+	}
+	// With only the home database the threshold can be applied in the aggregation
+	if len(regionalDatabases) == 0 {
+		pipeline = append(pipeline, bson.D{{"$match", bson.D{{"$expr", bson.D{{"$gt", bson.A{bson.D{{"$size", "$users"}}, config.fraudMaxAccounts}}}}}}})
+	}
+
+	accounts := make(map[string]map[int64]bool)
+	for _, residency := range residencies() {
+		_, _, watched, watchedArchive := residentEvents(residency)
+		cursor, err := watched.Aggregate(mctx, withArchivedEvents(pipeline, watchedArchive))
+		if err != nil {
+			return nil, err
+		}
+		var results []struct {
+			IpHash string  `bson:"_id"`
+			Users  []int64 `bson:"users"`
+		}
+		err = cursor.All(mctx, &results)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			if accounts[result.IpHash] == nil {
+				accounts[result.IpHash] = make(map[int64]bool)
+			}
+			for _, userId := range result.Users {
+				accounts[result.IpHash][userId] = true
+			}
+		}
+	}
+
+	ips := make([]string, 0)
+	for ip, users := range accounts {
+		if int64(len(users)) > config.fraudMaxAccounts {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+func scoreWatchFraud(since time.Time) error {
+	ips, err := findFraudulentIps(since)
+	if err != nil {
+		return err
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+
+	filter := bson.D{{"ip_hash", bson.D{{"$in", ips}}}, {"time", bson.D{{"$gte", since}}}, countedWatchFilter()}
+	update := bson.D{{"$set", bson.D{{"discounted", true}}}}
+	var discounted int64
+	views := make(map[int64]float64)
+	for _, residency := range residencies() {
+		_, _, watched, watchedArchive := residentEvents(residency)
+		for _, collection := range []*mongo.Collection{watched, watchedArchive} {
+			err := sumDiscountedViews(collection, filter, views)
+			if err != nil {
+				return err
+			}
+			result, err := collection.UpdateMany(mctx, filter, update)
+			if err != nil {
+				return err
+			}
+			discounted += result.ModifiedCount
+		}
+	}
+	// The watches were counted when they were made, they stop counting now
+	for videoId, weight := range views {
+		video, err := getVideo(mctx, videoId)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = incrementCounter(video, "views", -int64(math.Round(weight)))
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Discounted %d watches on %d videos from %d suspicious ips", discounted, len(views), len(ips))
+	return nil
+}
+
+// Adds up the watches the matching events stand for by video
+func sumDiscountedViews(collection *mongo.Collection, filter bson.D, views map[int64]float64) error {
+	cursor, err := collection.Aggregate(mctx, mongo.Pipeline{
+		{{"$match", filter}},
+		{{"$group", bson.D{{"_id", "$video_id"}, {"views", bson.D{{"$sum", watchWeightExpression()}}}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var results []struct {
+		VideoId int64   `bson:"_id"`
+		Views   float64 `bson:"views"`
+	}
+	err = cursor.All(mctx, &results)
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		views[result.VideoId] += result.Views
+	}
+	return nil
+}
+
+// Filter for watch events that should count towards counters and analytics
+func countedWatchFilter() bson.E {
+	return bson.E{Key: "discounted", Value: bson.D{{"$ne", true}}}
+}
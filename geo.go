@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultNearbyRadius = 10000
+	maxNearbyRadius     = 100000
+)
+
+var errInvalidLocation = errors.New("invalid location")
+
+// GeoPoint is a GeoJSON point, coordinates are [longitude, latitude]
+type GeoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+func newGeoPoint(latitude float64, longitude float64) (*GeoPoint, error) {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return nil, errInvalidLocation
+	}
+	return &GeoPoint{Type: "Point", Coordinates: []float64{longitude, latitude}}, nil
+}
+
+func createGeoIndex() {
+	_, err := videosCollection.Indexes().CreateOne(mctx, mongo.IndexModel{
+		Keys: bson.D{{"location", "2dsphere"}},
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func getNearbyVideos(ctx *fiber.Ctx) error {
+	latitude, err := strconv.ParseFloat(ctx.Query("lat"), 64)
+	if err != nil {
+		return err
+	}
+	longitude, err := strconv.ParseFloat(ctx.Query("lng"), 64)
+	if err != nil {
+		return err
+	}
+	point, err := newGeoPoint(latitude, longitude)
+	if err != nil {
+		return err
+	}
+	radius, err := strconv.ParseFloat(ctx.Query("radius", strconv.Itoa(defaultNearbyRadius)), 64)
+	if err != nil {
+		return err
+	}
+	if radius <= 0 || radius > maxNearbyRadius {
+		radius = maxNearbyRadius
+	}
+
+	filter := bson.D{
+		{"location", bson.D{{"$nearSphere", bson.D{
+			{"$geometry", point},
+			{"$maxDistance", radius},
+		}}}},
+		{"public", true},
+		{"taken_down", bson.D{{"$ne", true}}},
+	}
+	blocks, err := viewerBlockFilter(ctx)
+	if err != nil {
+		return err
+	}
+	filter = append(filter, blocks...)
+	filter = append(filter, regionFilter(viewerCountry(ctx))...)
+	cursor, err := videosCollection.Find(ctx.UserContext(), filter, options.Find().SetLimit(defaultPageSize))
+	if err != nil {
+		return err
+	}
+	videos := make([]Video, 0)
+	err = cursor.All(ctx.UserContext(), &videos)
+	if err != nil {
+		return err
+	}
+	return sendVideos(ctx, videos)
+}
+
+func locationFromUpload(upload VideoUpload) (*GeoPoint, error) {
+	if upload.Latitude == nil || upload.Longitude == nil {
+		return nil, nil
+	}
+	return newGeoPoint(*upload.Latitude, *upload.Longitude)
+}
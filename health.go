@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const readinessTimeout = 2 * time.Second
+
+type Readiness struct {
+	Ready   bool   `json:"ready"`
+	Mongo   string `json:"mongo"`
+	Storage string `json:"storage"`
+}
+
+// Registered ahead of admission control so probes and scrapes are never shed
+func registerHealthRoutes() {
+	app.Get("/healthz", func(ctx *fiber.Ctx) error {
+		return ctx.SendString("ok")
+	})
+	app.Get("/readyz", getReadiness)
+	app.Get("/metrics", getMetrics)
+}
+
+// Ready while mongo answers a ping and at least one storage portal is reachable, and not once shutdown started
+func getReadiness(ctx *fiber.Ctx) error {
+	readiness := Readiness{Mongo: "ok", Storage: "ok"}
+
+	pingCtx, cancel := context.WithTimeout(ctx.UserContext(), readinessTimeout)
+	defer cancel()
+	err := client.Ping(pingCtx, nil)
+	if err != nil {
+		readiness.Mongo = err.Error()
+	}
+
+	// Portal health comes from the background checks, so slow portals don't make the probe time out
+	readiness.Storage = errNoPortals.Error()
+	for _, portal := range storagePortals {
+		if portal.isHealthy() {
+			readiness.Storage = "ok"
+			break
+		}
+	}
+
+	readiness.Ready = readiness.Mongo == "ok" && readiness.Storage == "ok"
+	select {
+	case <-stopping:
+		readiness.Ready = false
+	default:
+	}
+	if !readiness.Ready {
+		ctx.Status(503)
+	}
+	return ctx.JSON(readiness)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type HistoryEntry struct {
+	Video
+	Time time.Time `json:"time"`
+}
+
+// Reads the user's events matching the filter newest first across both storage tiers,
+// continuing from ?before= with the RFC 3339 time of the last entry
+func userEvents(ctx *fiber.Ctx, hot *mongo.Collection, cold *mongo.Collection, filter bson.D) ([]HistoryEntry, error) {
+	limit, err := pageLimit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if before := ctx.Query("before"); before != "" {
+		beforeTime, err := time.Parse(time.RFC3339Nano, before)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, bson.E{Key: "time", Value: bson.D{{"$lt", beforeTime}}})
+	}
+	pipeline := withArchivedEvents(mongo.Pipeline{
+		{{"$match", filter}},
+		{{"$sort", bson.D{{"time", -1}}}},
+		{{"$limit", limit}},
+	}, cold)
+	cursor, err := hot.Aggregate(ctx.UserContext(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var events []struct {
+		VideoId int64     `bson:"video_id"`
+		Time    time.Time `bson:"time"`
+	}
+	err = cursor.All(ctx.UserContext(), &events)
+	if err != nil {
+		return nil, err
+	}
+
+	videoIds := make([]int64, len(events))
+	for i, event := range events {
+		videoIds[i] = event.VideoId
+	}
+	videos, err := getVideosInOrder(ctx.UserContext(), videoIds)
+	if err != nil {
+		return nil, err
+	}
+	err = withCreatorVerification(videos)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[int64]Video)
+	for _, video := range videos {
+		byId[video.Id] = video
+	}
+
+	entries := make([]HistoryEntry, 0, len(events))
+	for _, event := range events {
+		video, exists := byId[event.VideoId]
+		if !exists || video.TakenDown {
+			continue
+		}
+		entries = append(entries, HistoryEntry{Video: video, Time: event.Time})
+	}
+	return entries, nil
+}
+
+func getLikedVideos(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	residency, err := userResidency(ctx.UserContext(), userId)
+	if err != nil {
+		return err
+	}
+	liked, likedArchive, _, _ := residentEvents(residency)
+	entries, err := userEvents(ctx, liked, likedArchive, bson.D{{"user_id", userId}})
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(entries)
+}
+
+// Cleared watches are only hidden from the user, they still count towards analytics
+func clearWatchHistory(userId int64, filter bson.D) error {
+	residency, err := userResidency(mctx, userId)
+	if err != nil {
+		return err
+	}
+	update := bson.D{{"$set", bson.D{{"hidden_from_history", true}}}}
+	_, _, watched, watchedArchive := residentEvents(residency)
+	for _, collection := range []*mongo.Collection{watched, watchedArchive} {
+		_, err := collection.UpdateMany(mctx, filter, update)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerHistoryRoutes() {
+	app.Get("/history/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		filter := bson.D{{"user_id", userId}, {"hidden_from_history", bson.D{{"$ne", true}}}}
+		residency, err := userResidency(ctx.UserContext(), userId)
+		if err != nil {
+			return err
+		}
+		_, _, watched, watchedArchive := residentEvents(residency)
+		entries, err := userEvents(ctx, watched, watchedArchive, filter)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(entries)
+	})
+	app.Delete("/history/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		return clearWatchHistory(userId, bson.D{{"user_id", userId}})
+	})
+	app.Delete("/history/:user_id/:video_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		return clearWatchHistory(userId, bson.D{{"user_id", userId}, {"video_id", videoId}})
+	})
+}
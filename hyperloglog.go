@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Sketches use 2^12 registers, giving a standard error of about 1.6%
+const (
+	sketchPrecision = 12
+	sketchRegisters = 1 << sketchPrecision
+)
+
+type ViewerSketch struct {
+	VideoId   int64            `bson:"_id"`
+	Registers map[string]int32 `bson:"registers"`
+}
+
+// splitmix64 finalizer, user ids are sequential enough that they need mixing
+func hashUserId(userId int64) uint64 {
+	hash := uint64(userId)
+	hash ^= hash >> 30
+	hash *= 0xbf58476d1ce4e5b9
+	hash ^= hash >> 27
+	hash *= 0x94d049bb133111eb
+	hash ^= hash >> 31
+	return hash
+}
+
+func sketchPosition(userId int64) (int, int32) {
+	hash := hashUserId(userId)
+	register := int(hash >> (64 - sketchPrecision))
+	rank := int32(bits.LeadingZeros64(hash<<sketchPrecision|1<<(sketchPrecision-1)) + 1)
+	return register, rank
+}
+
+// Registers are only ever raised, so concurrent updates can't lose viewers. Returns whether a register was raised,
+// the estimate only changes when one was.
+func addViewer(videoId int64, userId int64) (bool, error) {
+	register, rank := sketchPosition(userId)
+	update := bson.D{{"$max", bson.D{{"registers." + strconv.Itoa(register), rank}}}}
+	result, err := viewerSketchesCollection.UpdateOne(mctx, bson.D{{"_id", videoId}}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0 || result.UpsertedCount > 0, nil
+}
+
+func estimateDistinctViewers(videoId int64) (int64, error) {
+	var sketch ViewerSketch
+	err := viewerSketchesCollection.FindOne(mctx, bson.D{{"_id", videoId}}).Decode(&sketch)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	sum := 0.0
+	for i := 0; i < sketchRegisters; i++ {
+		sum += math.Pow(2, -float64(sketch.Registers[strconv.Itoa(i)]))
+	}
+	m := float64(sketchRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// Linear counting is more accurate for small cardinalities
+	emptyRegisters := m - float64(len(sketch.Registers))
+	if estimate <= 2.5*m && emptyRegisters > 0 {
+		estimate = m * math.Log(m/emptyRegisters)
+	}
+	return int64(math.Round(estimate)), nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A request made with an Idempotency-Key, with its response once it completed
+type IdempotentRequest struct {
+	Key       string `bson:"_id"`
+	Method    string `bson:"method"`
+	Path      string `bson:"path"`
+	Completed bool   `bson:"completed"`
+	// Renewed while the request runs, a request whose lease ran out has crashed with the process
+	LeaseExpiresAt time.Time `bson:"lease_expires_at,omitempty"`
+	Status         int       `bson:"status,omitempty"`
+	ContentType    string    `bson:"content_type,omitempty"`
+	Body           []byte    `bson:"body,omitempty"`
+	CreatedAt      time.Time `bson:"created_at"`
+}
+
+// Client errors that may well go away on their own, a retry with the key should get to run again
+var transientStatuses = map[int]bool{
+	408: true,
+	409: true,
+	425: true,
+	429: true,
+}
+
+// Keys expire after the idempotency ttl
+func createIdempotencyIndex() {
+	_, err := idempotencyKeysCollection.Indexes().CreateOne(mctx, mongo.IndexModel{
+		Keys:    bson.D{{"created_at", 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(config.idempotencyTtl.Seconds())),
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Retries with the same Idempotency-Key get the first response instead of running again, keys are per user.
+// A request in progress holds the key with a lease it keeps renewing, so a retry can take over the key of a
+// request that never finished.
+func idempotent(ctx *fiber.Ctx) error {
+	idempotencyKey := ctx.Get("Idempotency-Key")
+	if idempotencyKey == "" {
+		return ctx.Next()
+	}
+	now := time.Now()
+	request := IdempotentRequest{
+		Key:            ctx.Params("user_id") + ":" + idempotencyKey,
+		Method:         ctx.Method(),
+		Path:           ctx.Path(),
+		LeaseExpiresAt: now.Add(config.idempotencyLease),
+		CreatedAt:      now,
+	}
+	_, err := idempotencyKeysCollection.InsertOne(ctx.UserContext(), request)
+	if mongo.IsDuplicateKeyError(err) {
+		var previous IdempotentRequest
+		err = idempotencyKeysCollection.FindOne(ctx.UserContext(), bson.D{{"_id", request.Key}}).Decode(&previous)
+		if err != nil {
+			return err
+		}
+		if previous.Method != request.Method || previous.Path != request.Path {
+			return fiber.NewError(422, "Idempotency key was used for another request")
+		}
+		if previous.Completed {
+			ctx.Set("Idempotent-Replayed", "true")
+			if previous.ContentType != "" {
+				ctx.Set(fiber.HeaderContentType, previous.ContentType)
+			}
+			ctx.Status(previous.Status)
+			return ctx.Send(previous.Body)
+		}
+		if previous.LeaseExpiresAt.After(now) {
+			return fiber.NewError(409, "Request with this idempotency key is in progress")
+		}
+		// Only one retry gets to take over, the others see the new lease
+		result, err := idempotencyKeysCollection.UpdateOne(ctx.UserContext(),
+			bson.D{{"_id", request.Key}, {"completed", false}, {"lease_expires_at", previous.LeaseExpiresAt}},
+			bson.D{{"$set", bson.D{{"lease_expires_at", request.LeaseExpiresAt}}}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return fiber.NewError(409, "Request with this idempotency key is in progress")
+		}
+	} else if err != nil {
+		return err
+	}
+
+	stopRenewing := renewIdempotencyLease(request.Key)
+	defer stopRenewing()
+
+	// Failed requests free the key so they can be retried, as do transient client errors such as rate limits.
+	// Other client errors are responses like any other, so they're rendered here to be kept.
+	err = ctx.Next()
+	var fiberError *fiber.Error
+	if errors.As(err, &fiberError) && fiberError.Code < 500 {
+		err = handleError(ctx, err)
+	}
+	status := ctx.Response().StatusCode()
+	if err != nil || status >= 500 || transientStatuses[status] {
+		_, deleteErr := idempotencyKeysCollection.DeleteOne(ctx.UserContext(), bson.D{{"_id", request.Key}})
+		if deleteErr != nil {
+			log.Print(deleteErr)
+		}
+		return err
+	}
+	update := bson.D{{"$set", bson.D{
+		{"completed", true},
+		{"status", status},
+		{"content_type", string(ctx.Response().Header.ContentType())},
+		{"body", append([]byte(nil), ctx.Response().Body()...)},
+	}}}
+	_, err = idempotencyKeysCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", request.Key}}, update)
+	return err
+}
+
+// Keeps extending the key's lease until the returned function is called
+func renewIdempotencyLease(key string) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(config.idempotencyLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, err := idempotencyKeysCollection.UpdateOne(mctx,
+					bson.D{{"_id", key}, {"completed", false}},
+					bson.D{{"$set", bson.D{{"lease_expires_at", time.Now().Add(config.idempotencyLease)}}}},
+				)
+				if err != nil {
+					log.Print(err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const snapshotBatchSize = 500
+
+type InterestSnapshot struct {
+	UserId    int64            `bson:"user_id" json:"user_id"`
+	Interests map[string]int64 `bson:"interests" json:"interests"`
+	Time      time.Time        `bson:"time" json:"time"`
+}
+
+func startInterestSnapshots() {
+	_, err := interestHistoryCollection.Indexes().CreateOne(mctx, mongo.IndexModel{
+		Keys: bson.D{{"user_id", 1}, {"time", -1}},
+	})
+	if err != nil {
+		log.Print(err)
+	}
+
+	every(config.interestSnapshotInterval, func() {
+		err := snapshotInterests()
+		if err != nil {
+			log.Print(err)
+		}
+	})
+}
+
+func snapshotInterests() error {
+	now := time.Now()
+	cursor, err := usersCollection.Find(mctx, bson.D{}, options.Find().SetProjection(bson.D{{"interests", 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(mctx)
+
+	batch := make([]interface{}, 0, snapshotBatchSize)
+	for cursor.Next(mctx) {
+		var user User
+		err = cursor.Decode(&user)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, InterestSnapshot{UserId: user.Id, Interests: user.Interests, Time: now})
+		if len(batch) == snapshotBatchSize {
+			_, err = interestHistoryCollection.InsertMany(mctx, batch)
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		_, err = interestHistoryCollection.InsertMany(mctx, batch)
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func getInterestHistory(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	filter := bson.D{{"user_id", userId}}
+	timeRange, err := queryTimeRange(ctx)
+	if err != nil {
+		return err
+	}
+	if len(timeRange) > 0 {
+		filter = append(filter, bson.E{Key: "time", Value: timeRange})
+	}
+	limit, err := pageLimit(ctx)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := interestHistoryCollection.Find(ctx.UserContext(), filter, options.Find().SetSort(bson.D{{"time", -1}}).SetLimit(limit))
+	if err != nil {
+		return err
+	}
+	snapshots := make([]InterestSnapshot, 0)
+	err = cursor.All(ctx.UserContext(), &snapshots)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(snapshots)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`about above after again against all also and any are because been before being
+		below between both but can could did does doing down during each few for from further had has have having
+		her here hers herself him himself his how into its itself just like more most myself nor not now off once
+		only other our ours ourselves out over own same she should some such than that the their theirs them
+		themselves then there these they this those through too under until very was were what when where which
+		while who whom why will with would you your yours yourself yourselves get got really gonna wanna lol omg`) {
+		stopwords[word] = true
+	}
+}
+
+// Picks the most frequent meaningful words of an English description as implicit tags, user hashtags,
+// mentions and links are left out. Other languages would need their own stopwords so get none.
+func extractKeywords(description string, language string, tags []string) []string {
+	keywords := make([]string, 0)
+	if language != "en" && language != "" {
+		return keywords
+	}
+	isTag := make(map[string]bool)
+	for _, tag := range tags {
+		isTag[tag] = true
+	}
+
+	counts := make(map[string]int)
+	order := make([]string, 0)
+	for _, word := range strings.Fields(description) {
+		if strings.HasPrefix(word, "#") || strings.HasPrefix(word, "@") || strings.Contains(word, "://") {
+			continue
+		}
+		word = strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}))
+		if len(word) < 3 || stopwords[word] || isTag[word] || strings.IndexFunc(word, unicode.IsLetter) == -1 {
+			continue
+		}
+		if counts[word] == 0 {
+			order = append(order, word)
+		}
+		counts[word]++
+	}
+
+	// Most frequent first, ties keep the order they appear in
+	sort.SliceStable(order, func(i, j int) bool {
+		return counts[order[i]] > counts[order[j]]
+	})
+	for _, word := range order {
+		if int64(len(keywords)) == config.keywordMaxTags {
+			break
+		}
+		keywords = append(keywords, word)
+	}
+	return keywords
+}
+
+// Keywords are a weaker signal than hashtags the creator picked
+func keywordInterestDelta(delta int64) int64 {
+	return int64(math.Round(float64(delta) * config.keywordInterestFactor))
+}
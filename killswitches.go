@@ -0,0 +1,175 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	killSwitchOff      = "off"
+	killSwitchReadOnly = "read_only"
+)
+
+// Turns a feature off or makes it read only, features without a switch are on
+type KillSwitch struct {
+	Feature   string    `bson:"_id" json:"feature"`
+	Mode      string    `bson:"mode" json:"mode"`
+	Reason    string    `bson:"reason" json:"reason"`
+	UpdatedBy int64     `bson:"updated_by" json:"updated_by"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type KillSwitchUpdate struct {
+	// off, read_only or on to remove the switch
+	Mode   string `json:"mode"`
+	Reason string `json:"reason"`
+}
+
+type featureRoute struct {
+	prefix string
+	// Any method when empty
+	method string
+	write  bool
+}
+
+// Routes of each feature that can be switched off, like and watch are writes even though they are GETs
+var featureRoutes = map[string][]featureRoute{
+	"uploads": {
+		{prefix: "/upload", write: true},
+	},
+	"likes": {
+		{prefix: "/like/", write: true},
+		{prefix: "/likes/"},
+	},
+	"watches": {
+		{prefix: "/watch/", write: true},
+	},
+	"comments": {
+		{prefix: "/comments/", method: fiber.MethodGet},
+		{prefix: "/comments/", write: true},
+	},
+}
+
+var (
+	killSwitches     = make(map[string]KillSwitch)
+	killSwitchesLock sync.RWMutex
+)
+
+// Loads the switches now and again every interval, so switches flipped through another instance are picked up
+func startKillSwitches() {
+	err := loadKillSwitches()
+	if err != nil {
+		log.Print(err)
+	}
+	every(config.killSwitchReloadInterval, func() {
+		err := loadKillSwitches()
+		if err != nil {
+			log.Print(err)
+		}
+	})
+}
+
+func loadKillSwitches() error {
+	cursor, err := killSwitchesCollection.Find(mctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	var stored []KillSwitch
+	err = cursor.All(mctx, &stored)
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]KillSwitch)
+	for _, killSwitch := range stored {
+		loaded[killSwitch.Feature] = killSwitch
+	}
+	killSwitchesLock.Lock()
+	killSwitches = loaded
+	killSwitchesLock.Unlock()
+	return nil
+}
+
+// The feature a request belongs to and whether it changes anything, or an empty feature
+func requestFeature(method string, path string) (string, bool) {
+	for feature, routes := range featureRoutes {
+		for _, route := range routes {
+			if strings.HasPrefix(path, route.prefix) && (route.method == "" || route.method == method) {
+				return feature, route.write
+			}
+		}
+	}
+	return "", false
+}
+
+// Rejects requests to switched off features, and writes to read only ones
+func checkKillSwitches(ctx *fiber.Ctx) error {
+	feature, write := requestFeature(ctx.Method(), ctx.Path())
+	if feature == "" {
+		return ctx.Next()
+	}
+	killSwitchesLock.RLock()
+	killSwitch, exists := killSwitches[feature]
+	killSwitchesLock.RUnlock()
+	if !exists || (killSwitch.Mode == killSwitchReadOnly && !write) {
+		return ctx.Next()
+	}
+
+	name := strings.ToUpper(feature[:1]) + feature[1:]
+	message := name + " are temporarily disabled"
+	if killSwitch.Mode == killSwitchReadOnly {
+		message = name + " are temporarily read only"
+	}
+	requestId, _ := ctx.Locals("requestid").(string)
+	return ctx.Status(503).JSON(ErrorResponse{Code: "feature_disabled", Message: message, RequestId: requestId})
+}
+
+func registerKillSwitchRoutes(admin fiber.Router) {
+	admin.Get("/kill_switches", func(ctx *fiber.Ctx) error {
+		cursor, err := killSwitchesCollection.Find(ctx.UserContext(), bson.D{})
+		if err != nil {
+			return err
+		}
+		stored := make([]KillSwitch, 0)
+		err = cursor.All(ctx.UserContext(), &stored)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(stored)
+	})
+	admin.Put("/kill_switches/:feature", func(ctx *fiber.Ctx) error {
+		var update KillSwitchUpdate
+		err := ctx.BodyParser(&update)
+		if err != nil {
+			return err
+		}
+		feature := ctx.Params("feature")
+		if _, exists := featureRoutes[feature]; !exists {
+			return fiber.NewError(400, "Unknown feature "+feature)
+		}
+
+		switch update.Mode {
+		case "on":
+			_, err = killSwitchesCollection.DeleteOne(ctx.UserContext(), bson.D{{"_id", feature}})
+		case killSwitchOff, killSwitchReadOnly:
+			killSwitch := KillSwitch{Feature: feature, Mode: update.Mode, Reason: update.Reason, UpdatedBy: adminId(ctx), UpdatedAt: time.Now()}
+			_, err = killSwitchesCollection.ReplaceOne(ctx.UserContext(), bson.D{{"_id", feature}}, killSwitch, options.Replace().SetUpsert(true))
+		default:
+			return fiber.NewError(400, "Mode must be on, off or read_only")
+		}
+		if err != nil {
+			return err
+		}
+		err = loadKillSwitches()
+		if err != nil {
+			return err
+		}
+		return recordAudit(adminId(ctx), "kill_switch_"+update.Mode, "feature", feature, update.Reason)
+	})
+}
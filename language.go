@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/abadojack/whatlanggo"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type LanguagesUpdate struct {
+	Languages []string `json:"languages"`
+}
+
+// Detects the ISO 639-1 language of a description, ignoring hashtags, mentions and links
+func detectLanguage(description string) string {
+	words := make([]string, 0)
+	for _, word := range strings.Fields(description) {
+		if strings.HasPrefix(word, "#") || strings.HasPrefix(word, "@") || strings.Contains(word, "://") {
+			continue
+		}
+		words = append(words, word)
+	}
+
+	info := whatlanggo.Detect(strings.Join(words, " "))
+	if !info.IsReliable() {
+		return ""
+	}
+	return info.Lang.Iso6391()
+}
+
+// Filter limiting videos to the user's preferred languages, videos with an unknown language always match
+func languageFilter(user User) bson.D {
+	if len(user.PreferredLanguages) == 0 {
+		return bson.D{}
+	}
+	languages := append([]string{""}, user.PreferredLanguages...)
+	return bson.D{{"language", bson.D{{"$in", languages}}}}
+}
+
+func setPreferredLanguages(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var update LanguagesUpdate
+	err = ctx.BodyParser(&update)
+	if err != nil {
+		return err
+	}
+
+	languages := make([]string, 0, len(update.Languages))
+	for _, language := range update.Languages {
+		language = strings.ToLower(language)
+		if len(language) == 2 {
+			languages = append(languages, language)
+		}
+	}
+	_, err = usersCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", userId}}, bson.D{{"$set", bson.D{{"preferred_languages", languages}}}})
+	return err
+}
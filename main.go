@@ -4,20 +4,24 @@ import (
 	"context"
 	"log"
 	"math"
-	"os"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/bluemediaapp/models"
+	"github.com/bwmarrin/snowflake"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
-	app    = fiber.New()
+	app    = fiber.New(fiber.Config{ErrorHandler: handleError})
 	client *mongo.Client
 	config *Config
+	idNode *snowflake.Node
 
 	mctx = context.Background()
 
@@ -25,19 +29,71 @@ var (
 	likedVideosCollection   *mongo.Collection
 	usersCollection         *mongo.Collection
 	watchedVideosCollection *mongo.Collection
+	auditCollection         *mongo.Collection
+	bannedTagsCollection    *mongo.Collection
+	soundsCollection        *mongo.Collection
+	watchLaterCollection    *mongo.Collection
+
+	playbackPositionsCollection   *mongo.Collection
+	playlistsCollection           *mongo.Collection
+	milestonesCollection          *mongo.Collection
+	quartileEventsCollection      *mongo.Collection
+	watchSessionsCollection       *mongo.Collection
+	followsCollection             *mongo.Collection
+	interestHistoryCollection     *mongo.Collection
+	pendingUploadsCollection      *mongo.Collection
+	commentsCollection            *mongo.Collection
+	viewerSketchesCollection      *mongo.Collection
+	dislikedVideosCollection      *mongo.Collection
+	savedVideosCollection         *mongo.Collection
+	sharesCollection              *mongo.Collection
+	blocksCollection              *mongo.Collection
+	commentLikesCollection        *mongo.Collection
+	translationsCollection        *mongo.Collection
+	creatorViewersCollection      *mongo.Collection
+	rollupCursorsCollection       *mongo.Collection
+	seriesCollection              *mongo.Collection
+	reportSubscriptionsCollection *mongo.Collection
+	replayConsumersCollection     *mongo.Collection
+	idempotencyKeysCollection     *mongo.Collection
+	videoReportsCollection        *mongo.Collection
+	blocklistsCollection          *mongo.Collection
+	killSwitchesCollection        *mongo.Collection
+	uploadPoliciesCollection      *mongo.Collection
+	reprocessJobsCollection       *mongo.Collection
+	nodeLeasesCollection          *mongo.Collection
+
+	likedVideosArchiveCollection   *mongo.Collection
+	watchedVideosArchiveCollection *mongo.Collection
 )
 
 type VideoUpload struct {
-	Description string `form:"description"`
-	Series      string `form:"series"`
+	Description     string   `form:"description"`
+	Series          string   `form:"series"`
+	ContentWarnings []string `form:"content_warnings"`
+	CoAuthors       []int64  `form:"co_authors"`
+	SourceVideoId   int64    `form:"source_video_id"`
+	RemixType       string   `form:"remix_type"`
+	SoundId         int64    `form:"sound_id"`
+	Latitude        *float64 `form:"lat"`
+	Longitude       *float64 `form:"lng"`
+	PlaceId         string   `form:"place_id"`
+	Sha256          string   `form:"sha256"`
+	// As reported by the client, only checked by upload policies
+	DurationSeconds float64 `form:"duration_seconds"`
 }
 
 func main() {
-	config = &Config{
-		port:     os.Getenv("port"),
-		mongoUri: os.Getenv("mongo_uri"),
-	}
-	app.Get("/like/:video_id/:user_id", func(ctx *fiber.Ctx) error {
+	config = loadConfig()
+
+	app.Use(observeRequests)
+	app.Use(requestid.New())
+	app.Use(contextRequestId)
+	registerHealthRoutes()
+	app.Use(traceRequests)
+	app.Use(admit)
+	app.Use(checkKillSwitches)
+	app.Get("/like/:video_id/:user_id", idempotent, dedupe, rateLimit("like", config.likeRateLimit, config.likeRatePeriod), func(ctx *fiber.Ctx) error {
 		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
 		if err != nil {
 			return err
@@ -47,27 +103,70 @@ func main() {
 			return err
 		}
 
-		if hasLiked(userId, videoId) {
-			_ = ctx.SendStatus(412)
-			_ = ctx.SendString("User has already liked this post")
-			return nil
+		if hasLiked(ctx.UserContext(), userId, videoId) {
+			return duplicateInteraction(ctx, "already_liked", "User has already liked this post")
 		}
 
-		user, err := getUser(userId)
+		user, err := getUser(ctx.UserContext(), userId)
 		if err != nil {
 			return err
 		}
 
-		video, err := getVideo(videoId)
+		video, err := getVideo(ctx.UserContext(), videoId)
 		if err != nil {
 			return err
 		}
+		if video.TakenDown {
+			return fiber.NewError(410, "Video has been taken down")
+		}
+		if !availableIn(video, viewerCountry(ctx)) {
+			return fiber.NewError(451, "Video is not available in your region")
+		}
+		if !canView(video, userId) {
+			return fiber.NewError(403, "Video is private")
+		}
+		if video.AgeRestricted && !canViewAgeRestricted(user) {
+			return fiber.NewError(403, "Video is age restricted")
+		}
+		blocked, err := isBlocked(video.CreatorId, userId)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return fiber.NewError(403, "User has been blocked by the creator")
+		}
 
-		err = likeVideo(user, video)
+		err = likeVideo(ctx.UserContext(), user, video)
 
 		return err
 	})
-	app.Get("/watch/:video_id/:user_id", func(ctx *fiber.Ctx) error {
+	app.Delete("/like/:video_id/:user_id", dedupe, func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		if !hasLiked(ctx.UserContext(), userId, videoId) {
+			return duplicateInteraction(ctx, "not_liked", "User has not liked this post")
+		}
+
+		user, err := getUser(ctx.UserContext(), userId)
+		if err != nil {
+			return err
+		}
+
+		video, err := getVideo(ctx.UserContext(), videoId)
+		if err != nil {
+			return err
+		}
+
+		return unlikeVideo(ctx.UserContext(), user, video)
+	})
+	app.Get("/watch/:video_id/:user_id", idempotent, dedupe, func(ctx *fiber.Ctx) error {
 		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
 		if err != nil {
 			return err
@@ -77,37 +176,165 @@ func main() {
 			return err
 		}
 
-		if hasWatched(userId, videoId) {
-			_ = ctx.SendStatus(412)
-			_ = ctx.SendString("User has already watched this post")
-			return nil
+		// Rewatches still count as views, but only move interests once per rewatch window
+		rewatch := hasWatchedRecently(ctx.UserContext(), userId, videoId)
+
+		user, err := getUser(ctx.UserContext(), userId)
+		if err != nil {
+			return err
 		}
 
-		user, err := getUser(userId)
+		video, err := getVideo(ctx.UserContext(), videoId)
 		if err != nil {
 			return err
 		}
+		if video.TakenDown {
+			return fiber.NewError(410, "Video has been taken down")
+		}
+		if !availableIn(video, viewerCountry(ctx)) {
+			return fiber.NewError(451, "Video is not available in your region")
+		}
+		if !canView(video, userId) {
+			return fiber.NewError(403, "Video is private")
+		}
+		if video.AgeRestricted && !canViewAgeRestricted(user) {
+			return fiber.NewError(403, "Video is age restricted")
+		}
 
-		video, err := getVideo(videoId)
+		stats, err := parseWatchStats(ctx)
 		if err != nil {
 			return err
 		}
 
-		err = watchVideo(user, video)
+		err = watchVideo(ctx.UserContext(), user, video, hashIp(ctx.IP()), stats, rewatch)
 		if err != nil {
 			return err
 		}
 		return nil
 	})
+	app.Post("/dislike/:video_id/:user_id", postDislike)
+	app.Post("/share/:video_id/:user_id", postShare)
+
+	app.Patch("/video/:video_id/age_restriction/:user_id", setAgeRestriction)
+	app.Patch("/video/:video_id/comment_policy/:user_id", setCommentPolicy)
+	app.Patch("/video/:video_id/permissions/:user_id", setPermissions)
+	app.Patch("/video/:video_id/regions/:user_id", setRegions)
+	app.Patch("/video/:video_id/visibility/:user_id", setVisibility)
+	app.Get("/download/:video_id/:user_id", getDownload)
+	app.Put("/users/:user_id/content_warnings", setHiddenContentWarnings)
+	app.Put("/users/:user_id/languages", setPreferredLanguages)
+	app.Get("/users/:user_id/interests/history", getInterestHistory)
+	app.Get("/users/:user_id/storage", getStorageUsage)
+	app.Post("/users/:user_id/interests/seed", seedInterests)
+	app.Get("/video/:video_id", getVideoHandler)
+	app.Patch("/video/:video_id/:user_id", updateVideo)
+	app.Delete("/video/:video_id/:user_id", deleteVideo)
+	app.Get("/video/:video_id/remixes", getRemixes)
+	app.Get("/video/:video_id/description/translate", translateDescription)
+	app.Get("/comments/:video_id/:comment_id/translate", translateComment)
+	uploadRateLimit := rateLimit("upload", config.uploadRateLimit, config.uploadRatePeriod)
+	app.Post("/upload-url/:user_id", idempotent, uploadRateLimit, uploadFromUrl)
+	app.Post("/upload-presign/:user_id", idempotent, uploadRateLimit, presignUpload)
+	app.Post("/upload-finalize/:upload_id/:user_id", idempotent, finalizeUpload)
+	app.Get("/search", searchVideos)
+	app.Get("/trending", getTrending)
+	app.Get("/tags/trending", getTrendingTags)
+	app.Get("/feed/:user_id", getFeed)
+	app.Get("/analytics/creator/:user_id/series/:series_id", getSeriesAnalytics)
+	app.Get("/analytics/creator/:user_id/video/:video_id/retention", getRetentionCurve)
+	app.Get("/analytics/creator/:user_id/video/:video_id/sessions", getSessionStats)
+	app.Get("/analytics/creator/:user_id/audience", getAudienceInsights)
+	app.Get("/analytics/creator/:user_id/cohorts", getCohortRetention)
+	// Ad-hoc reports for the BI team span every creator
+	app.Post("/analytics/query", internalAuth, queryAnalytics)
+	app.Get("/counts/:video_id", getCounts)
+	app.Post("/state/batch", getBatchInteractionState)
+	app.Get("/state/:video_id/:user_id", getInteractionState)
+	app.Get("/likes/:user_id", getLikedVideos)
+	app.Get("/play/:video_id", getPlayback)
+	app.Get("/videos/nearby", getNearbyVideos)
+	app.Get("/videos/creator/:creator_id", getCreatorVideos)
+	app.Get("/videos/tag/:tag", getTagVideos)
+	app.Get("/sound/:sound_id", getSoundHandler)
+	app.Get("/sound/:sound_id/videos", getSoundVideos)
+	app.Post("/coauthor/:video_id/:user_id/accept", func(ctx *fiber.Ctx) error {
+		return respondToCoAuthorship(ctx, coAuthorAccepted)
+	})
+	app.Post("/coauthor/:video_id/:user_id/decline", func(ctx *fiber.Ctx) error {
+		return respondToCoAuthorship(ctx, coAuthorDeclined)
+	})
+
+	registerWatchLaterRoutes()
+	registerProgressRoutes()
+	registerPlaylistRoutes()
+	registerCommentRoutes()
+	registerCommentLikeRoutes()
+	registerSavedRoutes()
+	registerBlockRoutes()
+	registerHistoryRoutes()
+	registerSeriesRoutes()
+	registerReportRoutes()
+	registerVideoReportRoutes()
+	registerAdminRoutes(app.Group("/admin", adminAuth))
+	internal := app.Group("/internal", internalAuth)
+	internal.Put("/video/:video_id/renditions/:quality", setRendition)
+	internal.Post("/video/:video_id/renditions", reportRenditions)
+	internal.Get("/export/signals", exportSignals)
+	internal.Post("/encryption/reencrypt", reencryptFields)
+	requireUserTokens()
 
+	loadTagEmbeddings()
+	initChaos()
+	initTracing()
+	initAuth()
+	initFieldEncryption()
+	initStorage()
+	initDirectUploads()
 	initDb()
-	log.Fatal(app.Listen(config.port))
+	initIdNode()
+	initResidency()
+	checkSchemas()
+	createGeoIndex()
+	createTextIndex()
+	createTagIndex()
+	createStorageIndex()
+	createWatchSessionIndex()
+	createFeedIndex()
+	createBlockIndex()
+	createCommentLikeIndex()
+	createIdempotencyIndex()
+	createAuditIndex()
+	backfillTrendingEligibility()
+	startBlocklists()
+	startKillSwitches()
+	startUploadPolicies()
+	startFraudScoring()
+	startEventArchiving()
+	startAdmissionControl()
+	startRequestDedupe()
+	startRateLimitSweep()
+	startInterestSnapshots()
+	startRollups()
+	startTrendingTags()
+	startReports()
+
+	go shutdownOnSignal()
+	err := app.Listen(config.port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	<-shutdownComplete
 }
 
 func initDb() {
 	// Connect mongo
 	var err error
-	client, err = mongo.NewClient(options.Client().ApplyURI(config.mongoUri))
+	clientOptions := options.Client().ApplyURI(config.mongoUri)
+	clientOptions.SetMonitor(mongoMonitor())
+	if config.chaosMode {
+		clientOptions.SetDialer(&chaosDialer{})
+	}
+	client, err = mongo.NewClient(clientOptions)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -118,54 +345,80 @@ func initDb() {
 	}
 
 	// Setup tables
-	db := client.Database("blue")
+	db := client.Database(config.mongoDatabase)
 	videosCollection = db.Collection("video_metadata")
 	likedVideosCollection = db.Collection("liked_videos")
 	watchedVideosCollection = db.Collection("watched_videos")
 	usersCollection = db.Collection("users")
+	auditCollection = db.Collection("admin_audit_log")
+	bannedTagsCollection = db.Collection("banned_tags")
+	soundsCollection = db.Collection("sounds")
+	watchLaterCollection = db.Collection("watch_later")
+	playbackPositionsCollection = db.Collection("playback_positions")
+	playlistsCollection = db.Collection("playlists")
+	milestonesCollection = db.Collection("milestones")
+	quartileEventsCollection = db.Collection("watch_quartiles")
+	watchSessionsCollection = db.Collection("watch_sessions")
+	followsCollection = db.Collection("follows")
+	interestHistoryCollection = db.Collection("interest_history")
+	pendingUploadsCollection = db.Collection("pending_uploads")
+	commentsCollection = db.Collection("comments")
+	viewerSketchesCollection = db.Collection("viewer_sketches")
+	dislikedVideosCollection = db.Collection("disliked_videos")
+	savedVideosCollection = db.Collection("saved_videos")
+	sharesCollection = db.Collection("shares")
+	blocksCollection = db.Collection("blocks")
+	commentLikesCollection = db.Collection("comment_likes")
+	translationsCollection = db.Collection("translations")
+	creatorViewersCollection = db.Collection("creator_viewers")
+	rollupCursorsCollection = db.Collection("rollup_cursors")
+	seriesCollection = db.Collection("series")
+	reportSubscriptionsCollection = db.Collection("report_subscriptions")
+	replayConsumersCollection = db.Collection("replay_consumers")
+	idempotencyKeysCollection = db.Collection("idempotency_keys")
+	videoReportsCollection = db.Collection("video_reports")
+	blocklistsCollection = db.Collection("blocklists")
+	killSwitchesCollection = db.Collection("kill_switches")
+	uploadPoliciesCollection = db.Collection("upload_policies")
+	reprocessJobsCollection = db.Collection("reprocess_jobs")
+	nodeLeasesCollection = db.Collection("snowflake_nodes")
+	likedVideosArchiveCollection = db.Collection("liked_videos_archive")
+	watchedVideosArchiveCollection = db.Collection("watched_videos_archive")
 }
 
 // Liking
-func hasLiked(userId int64, videoId int64) bool {
-	filter := bson.D{{"user_id", userId}, {"video_id", videoId}}
-	var limit int64 = 1
-	documentCount, err := likedVideosCollection.CountDocuments(mctx, filter, &options.CountOptions{
-		Limit: &limit,
-	})
+func hasLiked(ctx context.Context, userId int64, videoId int64) bool {
+	residency, err := userResidency(ctx, userId)
 	if err != nil {
 		return true
 	}
-	return documentCount == int64(1)
+	liked, likedArchive, _, _ := residentEvents(residency)
+	return hasEvent(liked, likedArchive, userId, videoId)
 }
-func likeVideo(user models.DatabaseUser, video models.DatabaseVideo) error {
+func likeVideo(ctx context.Context, user User, video Video) error {
 	// Duplicate checks
-	likeEvent := models.DatabaseLikeEvent{
-		VideoId: video.Id,
-		UserId:  user.Id,
+	likeEvent := LikeEvent{
+		DatabaseLikeEvent: models.DatabaseLikeEvent{
+			VideoId: video.Id,
+			UserId:  user.Id,
+		},
+		Time: time.Now(),
 	}
-	_, err := likedVideosCollection.InsertOne(mctx, likeEvent)
+	_, err := residentCollection(user.Residency, likedVideosCollection).InsertOne(ctx, likeEvent)
 	if err != nil {
 		return err
 	}
+	interactions.inc("like")
 
 	// Interests
-	interests := make(map[string]int64)
-	for _, tag := range video.Tags {
-		currentInterestValue, exists := user.Interests[tag]
-		if !exists {
-			currentInterestValue = 0
-		}
-		currentInterestValue += 11
-		interests[tag] = currentInterestValue
-	}
-	modifyInterests(user, interests)
+	adjustInterests(user, video, 11)
 
 	// Like count
 	if video.Likes >= math.MaxInt64-1 {
 		log.Printf("Max likes on video %d", video.Id)
 		return err
 	}
-	_, err = videosCollection.UpdateOne(mctx, bson.D{{"_id", video.Id}}, bson.D{{"$inc", bson.D{{"likes", 1}}}})
+	err = incrementCounter(video, "likes", 1)
 	if err != nil {
 		return err
 	}
@@ -173,34 +426,122 @@ func likeVideo(user models.DatabaseUser, video models.DatabaseVideo) error {
 	return nil
 }
 
-// Watching
-func watchVideo(user models.DatabaseUser, video models.DatabaseVideo) error {
-	watchEvent := models.DatabaseWatchEvent{
-		VideoId: video.Id,
-		UserId:  user.Id,
+func unlikeVideo(ctx context.Context, user User, video Video) error {
+	liked, likedArchive, _, _ := residentEvents(user.Residency)
+	result, err := liked.DeleteOne(ctx, bson.D{{"user_id", user.Id}, {"video_id", video.Id}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		result, err = likedArchive.DeleteOne(ctx, bson.D{{"user_id", user.Id}, {"video_id", video.Id}})
+		if err != nil {
+			return err
+		}
+	}
+	// Already removed by a concurrent request
+	if result.DeletedCount == 0 {
+		return nil
 	}
-	_, err := watchedVideosCollection.InsertOne(mctx, watchEvent)
+
+	// Roll back the interest boost from liking
+	adjustInterests(user, video, -11)
+
+	return incrementCounter(video, "likes", -1)
+}
+
+// Watching
+func watchVideo(ctx context.Context, user User, video Video, ipHash string, stats WatchStats, rewatch bool) error {
+	// Watches from users the creator blocked are kept for the viewer's own history but don't count
+	blocked, err := isBlocked(video.CreatorId, user.Id)
 	if err != nil {
 		return err
 	}
-	interests := make(map[string]int64)
-	for _, tag := range video.Tags {
-		currentInterestValue, exists := user.Interests[tag]
-		if !exists {
-			currentInterestValue = 0
+
+	// Counters stay exact, only the raw events are sampled on very popular videos. Watches that aren't sampled still
+	// leave one weightless event per user and video, which history, rewatch checks and the feed go by.
+	watched := residentCollection(user.Residency, watchedVideosCollection)
+	weight := sampleWatch(video)
+	if weight > 0 {
+		watchEvent := WatchEvent{
+			DatabaseWatchEvent: models.DatabaseWatchEvent{
+				VideoId: video.Id,
+				UserId:  user.Id,
+			},
+			IpHash:            ipHash,
+			Discounted:        blocked,
+			Weight:            weight,
+			WatchDurationMs:   stats.WatchDurationMs,
+			CompletionPercent: stats.CompletionPercent,
+			Time:              time.Now(),
+		}
+		_, err := watched.InsertOne(ctx, watchEvent)
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err := watched.UpdateOne(ctx,
+			bson.D{{"user_id", user.Id}, {"video_id", video.Id}, {"weight", 0}},
+			bson.D{
+				{"$set", bson.D{{"ip_hash", ipHash}, {"discounted", blocked}, {"time", time.Now()}}},
+				{"$unset", bson.D{{"hidden_from_history", ""}}},
+			},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			return err
 		}
-		currentInterestValue -= 1
-		interests[tag] = currentInterestValue
 	}
-	modifyInterests(user, interests)
+	interactions.inc("watch")
+	if finishedWatching(stats) {
+		err = removeFromWatchLater(user.Id, video.Id)
+		if err != nil {
+			return err
+		}
+	}
+	if !blocked {
+		err = incrementCounter(video, "views", 1)
+		if err != nil {
+			return err
+		}
+		raised, err := addViewer(video.Id, user.Id)
+		if err != nil {
+			return err
+		}
+		if raised {
+			err = updateDistinctViewers(video.Id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if !rewatch {
+		adjustInterests(user, video, watchInterestDelta(stats))
+	}
 
 	return nil
 }
 
-func hasWatched(userId int64, videoId int64) bool {
-	filter := bson.D{{"user_id", userId}, {"video_id", videoId}}
+func hasWatched(ctx context.Context, userId int64, videoId int64) bool {
+	residency, err := userResidency(ctx, userId)
+	if err != nil {
+		return true
+	}
+	_, _, watched, watchedArchive := residentEvents(residency)
+	return hasEvent(watched, watchedArchive, userId, videoId)
+}
+
+// Without a rewatch window any earlier watch counts, otherwise only watches inside the window do
+func hasWatchedRecently(ctx context.Context, userId int64, videoId int64) bool {
+	if config.rewatchWindow == 0 {
+		return hasWatched(ctx, userId, videoId)
+	}
+	residency, err := userResidency(ctx, userId)
+	if err != nil {
+		return true
+	}
+	filter := bson.D{{"user_id", userId}, {"video_id", videoId}, {"time", bson.D{{"$gte", time.Now().Add(-config.rewatchWindow)}}}}
 	var limit int64 = 1
-	documentCount, err := watchedVideosCollection.CountDocuments(mctx, filter, &options.CountOptions{
+	watched := residentCollection(residency, watchedVideosCollection)
+	documentCount, err := watched.CountDocuments(ctx, filter, &options.CountOptions{
 		Limit: &limit,
 	})
 	if err != nil {
@@ -210,36 +551,151 @@ func hasWatched(userId int64, videoId int64) bool {
 }
 
 // Utils
-func getUser(userId int64) (models.DatabaseUser, error) {
+func getUser(ctx context.Context, userId int64) (User, error) {
 	query := bson.D{{"_id", userId}}
-	rawUser := usersCollection.FindOne(mctx, query)
-	var user models.DatabaseUser
+	rawUser := usersCollection.FindOne(ctx, query)
+	var user User
 	err := rawUser.Decode(&user)
 	if err != nil {
-		return models.DatabaseUser{}, err
+		return User{}, err
 	}
 	return user, nil
 }
 
-func getVideo(videoId int64) (models.DatabaseVideo, error) {
+func getVideo(ctx context.Context, videoId int64) (Video, error) {
 	query := bson.D{{"_id", videoId}}
-	rawVideo := videosCollection.FindOne(mctx, query)
-	var video models.DatabaseVideo
+	rawVideo := videosCollection.FindOne(ctx, query)
+	var video Video
 	err := rawVideo.Decode(&video)
 	if err != nil {
-		return models.DatabaseVideo{}, err
+		return Video{}, err
 	}
 	return video, nil
 }
-func uploadVideo(video models.DatabaseVideo) error {
-	_, err := videosCollection.InsertOne(mctx, video)
+
+// Fetches videos keeping the order of the given ids, skipping any that no longer exist
+func getVideosInOrder(ctx context.Context, videoIds []int64) ([]Video, error) {
+	return filterVideosInOrder(ctx, videoIds, bson.D{})
+}
+
+// Checks that a new order contains exactly the current videos
+func sameVideos(current []int64, order []int64) bool {
+	if len(current) != len(order) {
+		return false
+	}
+	remaining := make(map[int64]bool)
+	for _, videoId := range current {
+		remaining[videoId] = true
+	}
+	for _, videoId := range order {
+		if !remaining[videoId] {
+			return false
+		}
+		delete(remaining, videoId)
+	}
+	return true
+}
+func uploadVideo(video Video) (Video, error) {
+	var err error
+	video.Tags, err = withoutBannedTags(video.Tags)
 	if err != nil {
-		return err
+		return Video{}, err
+	}
+	video.ContentWarnings = validContentWarnings(video.ContentWarnings)
+	video.Language = detectLanguage(video.Description)
+	video.Keywords, err = withoutBannedTags(extractKeywords(video.Description, video.Language, video.Tags))
+	if err != nil {
+		return Video{}, err
+	}
+	video.TrendingEligibleAt = trendingEligibleAt(time.Now())
+	if shouldHoldDescription(video.Description, video.Language) {
+		video.HeldForReview = true
+		video.Public = false
+	}
+	video.CoAuthors = pendingCoAuthors(video.CreatorId, video.CoAuthors)
+	video, err = withRemixSource(video)
+	if err != nil {
+		return Video{}, err
+	}
+	video, err = withSound(video)
+	if err != nil {
+		return Video{}, err
+	}
+	_, err = videosCollection.InsertOne(mctx, video)
+	if err != nil {
+		releaseSound(video)
+		return Video{}, err
+	}
+	interactions.inc("upload")
+	err = adjustStorageUsage(video.CreatorId, video.SizeBytes)
+	if err != nil {
+		return Video{}, err
+	}
+	notifyIndexer(video)
+	syncSearchIndex(video.Id)
+	generateCaptions(video)
+	return video, nil
+}
+
+// Changes the user's interest in everything about the video by delta
+func adjustInterests(user User, video Video, delta int64) {
+	interests := make(map[string]int64)
+	for _, tag := range interestTags(video) {
+		interests[tag] = delta
+	}
+	if keywordDelta := keywordInterestDelta(delta); keywordDelta != 0 {
+		for _, keyword := range video.Keywords {
+			if _, exists := interests[keyword]; !exists {
+				interests[keyword] = keywordDelta
+			}
+		}
+	}
+	expandInterests(interests, delta)
+	modifyInterests(user, interests)
+}
+
+// Drops tags the user has no real interest in so the map doesn't grow forever
+func pruneInterests(interests map[string]int64) {
+	for name, value := range interests {
+		if value <= config.interestFloor || (value >= -config.interestNearZero && value <= config.interestNearZero) {
+			delete(interests, name)
+		}
 	}
-	return nil
 }
-func modifyInterests(user models.DatabaseUser, interests map[string]int64) {
+
+// Evicts the lowest valued tags once there are more than the configured maximum
+func capInterests(interests map[string]int64) {
+	excess := int64(len(interests)) - config.interestMaxTags
+	if excess <= 0 {
+		return
+	}
+	names := make([]string, 0, len(interests))
+	for name := range interests {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return interests[names[i]] < interests[names[j]]
+	})
+	for _, name := range names[:excess] {
+		delete(interests, name)
+	}
+}
+
+// Everything about a video that user interests are tracked for
+func interestTags(video Video) []string {
+	tags := append([]string{}, video.Tags...)
+	if video.SoundId != 0 {
+		tags = append(tags, soundInterestTag(video.SoundId))
+	}
+	return tags
+}
+
+// Adds the deltas to the user's interests
+func modifyInterests(user User, interests map[string]int64) {
 	// Interests
+	if user.Interests == nil {
+		user.Interests = make(map[string]int64)
+	}
 	for name, value := range interests {
 		currentInterestValue, exists := user.Interests[name]
 		if !exists {
@@ -248,6 +704,8 @@ func modifyInterests(user models.DatabaseUser, interests map[string]int64) {
 		currentInterestValue += value
 		user.Interests[name] = currentInterestValue
 	}
+	pruneInterests(user.Interests)
+	capInterests(user.Interests)
 	update := bson.D{{"$set", bson.D{{"interests", user.Interests}}}}
 	filter := bson.D{{"_id", user.Id}}
 
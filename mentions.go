@@ -0,0 +1,108 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Only the first few mentions notify, so a comment can't be used to ping a crowd
+const maxMentions = 10
+
+type MentionEvent struct {
+	Type      string    `json:"type"`
+	UserId    int64     `json:"user_id"`
+	ActorId   int64     `json:"actor_id"`
+	VideoId   int64     `json:"video_id"`
+	CommentId int64     `json:"comment_id,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+func extractMentions(text string) []string {
+	usernames := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, word := range strings.Fields(text) {
+		if !strings.HasPrefix(word, "@") {
+			continue
+		}
+		username := strings.Trim(word, "@.,!?:;")
+		if username != "" && !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+	return usernames
+}
+
+// Looks up the mentioned users, skipping usernames that don't exist, the author and anyone who blocked the author
+func resolveMentions(text string, authorId int64) ([]int64, error) {
+	usernames := extractMentions(text)
+	userIds := make([]int64, 0)
+	if len(usernames) == 0 {
+		return userIds, nil
+	}
+	cursor, err := usersCollection.Find(mctx, bson.D{{"username", bson.D{{"$in", usernames}}}})
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	err = cursor.All(mctx, &users)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Id == authorId {
+			continue
+		}
+		blocked, err := isBlocked(user.Id, authorId)
+		if err != nil {
+			return nil, err
+		}
+		if !blocked {
+			userIds = append(userIds, user.Id)
+		}
+	}
+	return userIds, nil
+}
+
+func notifyCommentMentions(comment Comment, userIds []int64) {
+	if config.mentionWebhook == "" {
+		return
+	}
+	for _, userId := range userIds {
+		event := MentionEvent{
+			Type:      "comment_mention",
+			UserId:    userId,
+			ActorId:   comment.UserId,
+			VideoId:   comment.VideoId,
+			CommentId: comment.Id,
+			Time:      time.Now(),
+		}
+		background(func() {
+			err := postWebhookWithRetries(config.mentionWebhook, event, config.webhookAttempts)
+			if err != nil {
+				log.Print(err)
+			}
+		})
+	}
+}
+
+// Users mentioned in the edited comment that weren't mentioned before
+func newMentions(previous []int64, current []int64) []int64 {
+	mentioned := make(map[int64]bool)
+	for _, userId := range previous {
+		mentioned[userId] = true
+	}
+	added := make([]int64, 0)
+	for _, userId := range current {
+		if !mentioned[userId] {
+			added = append(added, userId)
+		}
+	}
+	return added
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Seconds, for request, mongo and storage durations
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Bytes, for uploaded video sizes
+var sizeBuckets = []float64{1 << 20, 5 << 20, 10 << 20, 25 << 20, 50 << 20, 100 << 20, 250 << 20, 500 << 20, 1 << 30}
+
+var (
+	httpRequests          = newCounter("http_requests_total", "Requests handled, by route, method and status.", "route", "method", "status")
+	httpRequestDuration   = newHistogram("http_request_duration_seconds", "Time taken to handle requests, by route and method.", durationBuckets, "route", "method")
+	mongoCommandDuration  = newHistogram("mongo_command_duration_seconds", "Time taken by mongo commands, by command and whether they failed.", durationBuckets, "command", "status")
+	storageUploadDuration = newHistogram("storage_upload_duration_seconds", "Time taken to store videos, by portal and whether it failed.", durationBuckets, "portal", "status")
+	storageUploadSize     = newHistogram("storage_upload_size_bytes", "Size of stored videos.", sizeBuckets)
+	interactions          = newCounter("interactions_total", "Likes, watches and uploads recorded, by kind.", "kind")
+)
+
+// Metrics are kept in their own registry so only the service's own are exposed
+var metricsRegistry = prometheus.NewRegistry()
+
+type counter struct {
+	vec *prometheus.CounterVec
+}
+
+type histogram struct {
+	vec *prometheus.HistogramVec
+}
+
+func newCounter(name string, help string, labels ...string) *counter {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	metricsRegistry.MustRegister(vec)
+	return &counter{vec}
+}
+
+func newHistogram(name string, help string, buckets []float64, labels ...string) *histogram {
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	metricsRegistry.MustRegister(vec)
+	return &histogram{vec}
+}
+
+// Label values are passed in the order the labels were declared
+func (c *counter) inc(values ...string) {
+	c.vec.WithLabelValues(values...).Inc()
+}
+
+// Observations made under a sampled span carry its trace id as an exemplar, to jump from a latency spike to a trace
+func (h *histogram) observe(ctx context.Context, value float64, values ...string) {
+	observer := h.vec.WithLabelValues(values...)
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsSampled() {
+		observer.Observe(value)
+		return
+	}
+	observer.(prometheus.ExemplarObserver).ObserveWithExemplar(value, prometheus.Labels{"trace_id": spanContext.TraceID().String()})
+}
+
+func (h *histogram) observeDuration(ctx context.Context, start time.Time, values ...string) {
+	h.observe(ctx, time.Since(start).Seconds(), values...)
+}
+
+// Exemplars are only part of the OpenMetrics format, which is served to scrapers that ask for it
+var metricsHandler = fasthttpadaptor.NewFastHTTPHandler(promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+
+func getMetrics(ctx *fiber.Ctx) error {
+	metricsHandler(ctx.Context())
+	return nil
+}
+
+// Counts and times every request by its route pattern, so ids in paths don't each get their own series.
+// Errors are rendered here rather than by the app so their status is counted.
+func observeRequests(ctx *fiber.Ctx) error {
+	start := time.Now()
+	err := ctx.Next()
+	if err != nil {
+		err = handleError(ctx, err)
+	}
+	route := ctx.Route().Path
+	if ctx.Response().StatusCode() == 404 && route == "/" {
+		route = "unmatched"
+	}
+	httpRequests.inc(route, ctx.Method(), strconv.Itoa(ctx.Response().StatusCode()))
+	httpRequestDuration.observeDuration(ctx.UserContext(), start, route, ctx.Method())
+	return err
+}
+
+func statusLabel(failed bool) string {
+	if failed {
+		return "failed"
+	}
+	return "ok"
+}
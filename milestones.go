@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var milestones = []int64{1000, 10000, 100000, 1000000}
+
+type MilestoneEvent struct {
+	Id        string    `bson:"_id" json:"-"`
+	VideoId   int64     `bson:"video_id" json:"video_id"`
+	CreatorId int64     `bson:"creator_id" json:"creator_id"`
+	Counter   string    `bson:"counter" json:"counter"`
+	Milestone int64     `bson:"milestone" json:"milestone"`
+	Time      time.Time `bson:"time" json:"time"`
+}
+
+// Increments one of the video's counters, keeping the engagement rate up to date and firing any milestones it crosses
+func incrementCounter(video Video, counter string, amount int64) error {
+	update := mongo.Pipeline{
+		{{"$set", bson.D{{counter, bson.D{{"$add", bson.A{bson.D{{"$ifNull", bson.A{"$" + counter, 0}}}, amount}}}}}}},
+	}
+	if counter == "likes" || counter == "shares" {
+		update = append(update, bson.D{{"$set", warmupEngagementExpression(amount)}})
+	}
+	update = append(update, bson.D{{"$set", engagementRateExpression()}})
+	var updated bson.M
+	err := videosCollection.FindOneAndUpdate(mctx,
+		bson.D{{"_id", video.Id}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.D{{counter, 1}}),
+	).Decode(&updated)
+	if err != nil {
+		return err
+	}
+	var newValue int64
+	switch value := updated[counter].(type) {
+	case int64:
+		newValue = value
+	case int32:
+		newValue = int64(value)
+	}
+	for _, milestone := range milestones {
+		if newValue-amount < milestone && newValue >= milestone {
+			fireMilestone(video, counter, milestone)
+		}
+	}
+	return nil
+}
+
+// The milestone id makes sure each one is only ever fired once
+func fireMilestone(video Video, counter string, milestone int64) {
+	event := MilestoneEvent{
+		Id:        fmt.Sprintf("%d:%s:%d", video.Id, counter, milestone),
+		VideoId:   video.Id,
+		CreatorId: video.CreatorId,
+		Counter:   counter,
+		Milestone: milestone,
+		Time:      time.Now(),
+	}
+	_, err := milestonesCollection.InsertOne(mctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		return
+	}
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	if config.milestoneWebhook == "" {
+		return
+	}
+	background(func() {
+		err := postWebhook(config.milestoneWebhook, event)
+		if err != nil {
+			log.Print(err)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bluemediaapp/models"
+)
+
+// Video extends the shared video model with the fields this service tracks.
+type Video struct {
+	models.DatabaseVideo `bson:",inline"`
+
+	Views          int64   `bson:"views" json:"views"`
+	Comments       int64   `bson:"comments" json:"comments"`
+	Shares         int64   `bson:"shares" json:"shares"`
+	EngagementRate float64 `bson:"engagement_rate" json:"engagement_rate"`
+
+	TrendingEligibleAt time.Time `bson:"trending_eligible_at" json:"-"`
+	// Likes and shares made during the trending warm-up, which are discounted in the engagement rate
+	WarmupEngagements int64 `bson:"warmup_engagements,omitempty" json:"-"`
+	// Estimated from the viewer sketch, the engagement rate is per distinct viewer
+	DistinctViewers int64 `bson:"distinct_viewers,omitempty" json:"-"`
+
+	TakenDown       bool       `bson:"taken_down" json:"taken_down"`
+	HeldForReview   bool       `bson:"held_for_review,omitempty" json:"held_for_review,omitempty"`
+	Visibility      string     `bson:"visibility,omitempty" json:"visibility,omitempty"`
+	AgeRestricted   bool       `bson:"age_restricted" json:"age_restricted"`
+	ContentWarnings []string   `bson:"content_warnings" json:"content_warnings"`
+	CoAuthors       []CoAuthor `bson:"co_authors" json:"co_authors"`
+
+	// Duets and stitches
+	SourceVideoId int64   `bson:"source_video_id,omitempty" json:"source_video_id,omitempty"`
+	RemixType     string  `bson:"remix_type,omitempty" json:"remix_type,omitempty"`
+	Lineage       []int64 `bson:"lineage,omitempty" json:"lineage,omitempty"`
+
+	SoundId int64 `bson:"sound_id,omitempty" json:"sound_id,omitempty"`
+
+	Location *GeoPoint `bson:"location,omitempty" json:"location,omitempty"`
+	PlaceId  string    `bson:"place_id,omitempty" json:"place_id,omitempty"`
+
+	Language string `bson:"language" json:"language"`
+	// Implicit tags extracted from the description, kept apart from the creator's hashtags
+	Keywords []string `bson:"keywords,omitempty" json:"keywords,omitempty"`
+
+	AllowedCountries []string `bson:"allowed_countries,omitempty" json:"allowed_countries,omitempty"`
+	BlockedCountries []string `bson:"blocked_countries,omitempty" json:"blocked_countries,omitempty"`
+
+	CommentPolicy string `bson:"comment_policy,omitempty" json:"comment_policy"`
+	AllowDownload *bool  `bson:"allow_download,omitempty" json:"allow_download,omitempty"`
+	AllowDuet     *bool  `bson:"allow_duet,omitempty" json:"allow_duet,omitempty"`
+	AllowStitch   *bool  `bson:"allow_stitch,omitempty" json:"allow_stitch,omitempty"`
+
+	Captions []Caption `bson:"captions,omitempty" json:"captions,omitempty"`
+
+	// Quality to storage key, filled in by the transcoding pipeline
+	Renditions map[string]string `bson:"renditions,omitempty" json:"renditions,omitempty"`
+	// Size of the uploaded file, renditions aren't counted
+	SizeBytes int64 `bson:"size_bytes,omitempty" json:"size_bytes,omitempty"`
+
+	// Filled in for responses
+	CreatorVerified bool `bson:"-" json:"creator_verified"`
+}
+
+type CoAuthor struct {
+	UserId int64  `bson:"user_id" json:"user_id"`
+	Status string `bson:"status" json:"status"`
+}
+
+type Sound struct {
+	Id              int64  `bson:"_id" json:"id"`
+	Title           string `bson:"title" json:"title"`
+	CreatorId       int64  `bson:"creator_id" json:"creator_id"`
+	OriginalVideoId int64  `bson:"original_video_id" json:"original_video_id"`
+	Uses            int64  `bson:"uses" json:"uses"`
+}
+
+// User extends the shared user model with the fields this service tracks.
+type User struct {
+	models.DatabaseUser `bson:",inline"`
+
+	Birthdate   *time.Time `bson:"birthdate,omitempty" json:"-"`
+	VerifiedAge int64      `bson:"verified_age,omitempty" json:"-"`
+	Verified    bool       `bson:"verified" json:"verified"`
+
+	HiddenContentWarnings []string `bson:"hidden_content_warnings" json:"hidden_content_warnings"`
+	PreferredLanguages    []string `bson:"preferred_languages" json:"preferred_languages"`
+
+	// Region whose database keeps the user's like and watch events, for data residency
+	Residency string `bson:"residency,omitempty" json:"residency,omitempty"`
+	// Total size of the videos the user uploaded
+	StorageBytes int64 `bson:"storage_bytes,omitempty" json:"-"`
+}
+
+// LikeEvent extends the shared like event with the fields this service tracks.
+type LikeEvent struct {
+	models.DatabaseLikeEvent `bson:",inline"`
+
+	Time time.Time `bson:"time" json:"time"`
+}
+
+// WatchEvent extends the shared watch event with the fields this service tracks.
+type WatchEvent struct {
+	models.DatabaseWatchEvent `bson:",inline"`
+
+	IpHash     string `bson:"ip_hash,omitempty" json:"-"`
+	Discounted bool   `bson:"discounted" json:"discounted"`
+	// How many watches a sampled event stands for, 0 on the event marking watches that weren't sampled
+	Weight            float64   `bson:"weight,omitempty" json:"weight,omitempty"`
+	WatchDurationMs   int64     `bson:"watch_duration_ms,omitempty" json:"watch_duration_ms,omitempty"`
+	CompletionPercent *float64  `bson:"completion_percent,omitempty" json:"completion_percent,omitempty"`
+	HiddenFromHistory bool      `bson:"hidden_from_history,omitempty" json:"-"`
+	Time              time.Time `bson:"time" json:"time"`
+}
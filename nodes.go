@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errNoFreeNodes = errors.New("every snowflake node is leased")
+
+const (
+	nodeLeaseTtl     = time.Minute
+	nodeLeaseRenewal = nodeLeaseTtl / 3
+)
+
+// Highest node the snowflake package accepts
+var maxNode = int64(-1 ^ (-1 << snowflake.NodeBits))
+
+// Who holds a snowflake node, instances lease one so their ids never collide
+type NodeLease struct {
+	Node      int64     `bson:"_id"`
+	Holder    string    `bson:"holder"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// Identifies this process in leases
+var nodeHolder = func() string {
+	hostname, _ := os.Hostname()
+	return hostname + "/" + strconv.Itoa(os.Getpid()) + "/" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}()
+
+// Until when the leased node is ours, ids mustn't be generated past it as another instance may have taken the node
+var nodeLeaseExpiresAt time.Time
+
+// Uses snowflake_node when it is set, otherwise leases a free node and keeps renewing the lease
+func initIdNode() {
+	node := config.snowflakeNode
+	if node < 0 {
+		var err error
+		node, err = leaseNode()
+		if err != nil {
+			log.Fatalf("Couldn't lease a snowflake node: %s", err)
+		}
+		log.Printf("Leased snowflake node %d", node)
+		every(nodeLeaseRenewal, func() {
+			renewNodeLease(node)
+		})
+	}
+	var err error
+	idNode, err = snowflake.NewNode(node)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Claims the first node without a live lease. Claiming a node someone else holds tries to insert it
+// again, which the unique _id refuses.
+func leaseNode() (int64, error) {
+	cursor, err := nodeLeasesCollection.Find(mctx, bson.D{{"expires_at", bson.D{{"$gte", time.Now()}}}}, options.Find().SetProjection(bson.D{{"_id", 1}}))
+	if err != nil {
+		return 0, err
+	}
+	var held []NodeLease
+	err = cursor.All(mctx, &held)
+	if err != nil {
+		return 0, err
+	}
+	taken := make(map[int64]bool)
+	for _, lease := range held {
+		taken[lease.Node] = true
+	}
+
+	for node := int64(0); node <= maxNode; node++ {
+		if taken[node] {
+			continue
+		}
+		now := time.Now()
+		expiresAt := now.Add(nodeLeaseTtl)
+		_, err = nodeLeasesCollection.UpdateOne(mctx,
+			bson.D{{"_id", node}, {"expires_at", bson.D{{"$lt", now}}}},
+			bson.D{{"$set", bson.D{{"holder", nodeHolder}, {"expires_at", expiresAt}}}},
+			options.Update().SetUpsert(true),
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		nodeLeaseExpiresAt = expiresAt
+		return node, nil
+	}
+	return 0, errNoFreeNodes
+}
+
+// Losing the lease means another instance may be generating the same ids, so this one stops. So does failing
+// to renew it until it expires, the renewal gives up at the expiry so a hanging call can't outlive the lease.
+func renewNodeLease(node int64) {
+	rctx, cancel := context.WithDeadline(mctx, nodeLeaseExpiresAt)
+	defer cancel()
+	// Taken before the call so the lease is never thought to last longer than it does
+	expiresAt := time.Now().Add(nodeLeaseTtl)
+	result, err := nodeLeasesCollection.UpdateOne(rctx,
+		bson.D{{"_id", node}, {"holder", nodeHolder}},
+		bson.D{{"$set", bson.D{{"expires_at", expiresAt}}}},
+	)
+	if err != nil {
+		if !time.Now().Before(nodeLeaseExpiresAt) {
+			log.Fatalf("Snowflake node %d lease expired without being renewed: %s", node, err)
+		}
+		// The lease is still valid for a while, the next renewal may work
+		log.Printf("Couldn't renew snowflake node lease: %s", err)
+		return
+	}
+	if result.MatchedCount == 0 {
+		log.Fatalf("Lost the lease on snowflake node %d", node)
+	}
+	nodeLeaseExpiresAt = expiresAt
+}
+
+// Lets another instance take the node straight away
+func releaseNodeLease() {
+	if config.snowflakeNode >= 0 || idNode == nil {
+		return
+	}
+	_, err := nodeLeasesCollection.DeleteOne(mctx, bson.D{{"holder", nodeHolder}})
+	if err != nil {
+		log.Print(err)
+	}
+}
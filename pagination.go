@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errInvalidSort = errors.New("invalid sort")
+
+// Video listings can be sorted by any of these, newest first is the default
+var videoSorts = map[string]string{
+	"newest":     "_id",
+	"likes":      "likes",
+	"engagement": "engagement_rate",
+}
+
+var commentSorts = map[string]string{
+	"newest": "_id",
+	"top":    "likes",
+}
+
+func pageLimit(ctx *fiber.Ctx) (int64, error) {
+	limit, err := strconv.ParseInt(ctx.Query("limit", strconv.Itoa(defaultPageSize)), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 || limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return limit, nil
+}
+
+// Pages newest first using the snowflake ids as a cursor, passed back in as ?before=
+func paginate(ctx *fiber.Ctx, filter bson.D) (bson.D, *options.FindOptions, error) {
+	limit, err := pageLimit(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if before := ctx.Query("before"); before != "" {
+		beforeId, err := strconv.ParseInt(before, 10, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{"$lt", beforeId}}})
+	}
+	return filter, options.Find().SetSort(bson.D{{"_id", -1}}).SetLimit(limit), nil
+}
+
+// Like paginate, but supports ?sort= with the id of the last video still being the cursor
+func paginateVideos(ctx *fiber.Ctx, filter bson.D) (bson.D, *options.FindOptions, error) {
+	return paginateSorted(ctx, filter, videosCollection, videoSorts)
+}
+
+// Pages through the collection by the ?sort= picked from sorts, using the id of the last document as the cursor
+func paginateSorted(ctx *fiber.Ctx, filter bson.D, collection *mongo.Collection, sorts map[string]string) (bson.D, *options.FindOptions, error) {
+	sortField, exists := sorts[ctx.Query("sort", "newest")]
+	if !exists {
+		return nil, nil, errInvalidSort
+	}
+	if sortField == "_id" {
+		return paginate(ctx, filter)
+	}
+
+	limit, err := pageLimit(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if before := ctx.Query("before"); before != "" {
+		beforeId, err := strconv.ParseInt(before, 10, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		var cursorDocument bson.M
+		err = collection.FindOne(ctx.UserContext(), bson.D{{"_id", beforeId}}, options.FindOne().SetProjection(bson.D{{sortField, 1}})).Decode(&cursorDocument)
+		if err != nil {
+			return nil, nil, err
+		}
+		cursorValue := cursorDocument[sortField]
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{sortField, bson.D{{"$lt", cursorValue}}}},
+			bson.D{{sortField, cursorValue}, {"_id", bson.D{{"$lt", beforeId}}}},
+		}})
+	}
+	return filter, options.Find().SetSort(bson.D{{sortField, -1}, {"_id", -1}}).SetLimit(limit), nil
+}
+
+// Reads ?since= and ?until= as RFC 3339 times into a range for filtering
+func queryTimeRange(ctx *fiber.Ctx) (bson.D, error) {
+	timeRange := bson.D{}
+	if since := ctx.Query("since"); since != "" {
+		sinceTime, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, err
+		}
+		timeRange = append(timeRange, bson.E{Key: "$gte", Value: sinceTime})
+	}
+	if until := ctx.Query("until"); until != "" {
+		untilTime, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, err
+		}
+		timeRange = append(timeRange, bson.E{Key: "$lt", Value: untilTime})
+	}
+	return timeRange, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type PermissionsUpdate struct {
+	AllowDownload *bool `json:"allow_download"`
+	AllowDuet     *bool `json:"allow_duet"`
+	AllowStitch   *bool `json:"allow_stitch"`
+}
+
+// Permissions default to allowed until the creator turns them off
+func allowed(permission *bool) bool {
+	return permission == nil || *permission
+}
+
+func (video Video) allowsRemix(remixType string) bool {
+	if remixType == remixStitch {
+		return allowed(video.AllowStitch)
+	}
+	return allowed(video.AllowDuet)
+}
+
+func setPermissions(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var update PermissionsUpdate
+	err = ctx.BodyParser(&update)
+	if err != nil {
+		return err
+	}
+
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err != nil {
+		return err
+	}
+	if video.CreatorId != userId {
+		return fiber.NewError(403, "Only the creator can change this video")
+	}
+
+	changes := bson.D{}
+	if update.AllowDownload != nil {
+		changes = append(changes, bson.E{Key: "allow_download", Value: *update.AllowDownload})
+	}
+	if update.AllowDuet != nil {
+		changes = append(changes, bson.E{Key: "allow_duet", Value: *update.AllowDuet})
+	}
+	if update.AllowStitch != nil {
+		changes = append(changes, bson.E{Key: "allow_stitch", Value: *update.AllowStitch})
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	_, err = videosCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", videoId}}, bson.D{{"$set", changes}})
+	return err
+}
+
+func getDownload(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err != nil {
+		return err
+	}
+	if video.TakenDown {
+		return fiber.NewError(410, "Video has been taken down")
+	}
+	if !availableIn(video, viewerCountry(ctx)) {
+		return fiber.NewError(451, "Video is not available in your region")
+	}
+	if !canView(video, userId) {
+		return fiber.NewError(403, "Video is private")
+	}
+	if video.AgeRestricted {
+		user, err := getUser(ctx.UserContext(), userId)
+		if err != nil {
+			return err
+		}
+		if !canViewAgeRestricted(user) {
+			return fiber.NewError(403, "Video is age restricted")
+		}
+	}
+	if video.CreatorId != userId && !allowed(video.AllowDownload) {
+		return fiber.NewError(403, "The creator has disabled downloads for this video")
+	}
+
+	return ctx.JSON(Rendition{Quality: "original", StorageKey: video.StorageKey})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Rendition struct {
+	Quality    string `json:"quality"`
+	StorageKey string `json:"storage_key"`
+}
+
+// Qualities are named by their height, eg. 720p
+func qualityHeight(quality string) int {
+	height, err := strconv.Atoi(strings.TrimSuffix(quality, "p"))
+	if err != nil {
+		return 0
+	}
+	return height
+}
+
+// Picks the requested quality, falling back to the best one below it, then the lowest one above it
+func pickRendition(video Video, quality string) Rendition {
+	if len(video.Renditions) == 0 {
+		return Rendition{Quality: "original", StorageKey: video.StorageKey}
+	}
+	if storageKey, exists := video.Renditions[quality]; exists {
+		return Rendition{Quality: quality, StorageKey: storageKey}
+	}
+
+	qualities := make([]string, 0, len(video.Renditions))
+	for available := range video.Renditions {
+		qualities = append(qualities, available)
+	}
+	sort.Slice(qualities, func(i, j int) bool {
+		return qualityHeight(qualities[i]) > qualityHeight(qualities[j])
+	})
+
+	wanted := qualityHeight(quality)
+	picked := qualities[len(qualities)-1]
+	if wanted == 0 {
+		picked = qualities[0]
+	}
+	for _, available := range qualities {
+		if qualityHeight(available) <= wanted {
+			picked = available
+			break
+		}
+	}
+	return Rendition{Quality: picked, StorageKey: video.Renditions[picked]}
+}
+
+func setRendition(ctx *fiber.Ctx) error {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var rendition Rendition
+	err = ctx.BodyParser(&rendition)
+	if err != nil {
+		return err
+	}
+	quality := ctx.Params("quality")
+	if qualityHeight(quality) == 0 || rendition.StorageKey == "" {
+		return fiber.NewError(400, "Invalid rendition")
+	}
+
+	update := bson.D{{"$set", bson.D{{"renditions." + quality, rendition.StorageKey}}}}
+	_, err = videosCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", videoId}}, update)
+	return err
+}
+
+func getPlayback(ctx *fiber.Ctx) error {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err != nil {
+		return err
+	}
+	if video.TakenDown {
+		return fiber.NewError(410, "Video has been taken down")
+	}
+	if !availableIn(video, viewerCountry(ctx)) {
+		return fiber.NewError(451, "Video is not available in your region")
+	}
+	viewer := viewerId(ctx)
+	if !canView(video, viewer) {
+		return fiber.NewError(403, "Video is private")
+	}
+	if video.AgeRestricted {
+		var user User
+		if viewer != 0 {
+			user, err = getUser(ctx.UserContext(), viewer)
+			if err != nil {
+				return err
+			}
+		}
+		if viewer == 0 || !canViewAgeRestricted(user) {
+			return fiber.NewError(403, "Video is age restricted")
+		}
+	}
+
+	return ctx.JSON(pickRendition(video, ctx.Query("quality")))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Playlist struct {
+	Id        int64     `bson:"_id" json:"id"`
+	OwnerId   int64     `bson:"owner_id" json:"owner_id"`
+	Name      string    `bson:"name" json:"name"`
+	Public    bool      `bson:"public" json:"public"`
+	Videos    []int64   `bson:"videos" json:"videos"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+type PlaylistUpdate struct {
+	Name   *string `json:"name"`
+	Public *bool   `json:"public"`
+	Videos []int64 `json:"videos"`
+}
+
+type PlaylistResponse struct {
+	Playlist
+	VideoDetails []Video `json:"video_details"`
+}
+
+const maxPlaylistNameLength = 100
+
+func validPlaylistName(name string) bool {
+	return name != "" && len(name) <= maxPlaylistNameLength
+}
+
+// Loads a playlist for modification, returning ok=false with the error to respond with when the user can't modify it
+func getOwnedPlaylist(ctx *fiber.Ctx) (Playlist, bool, error) {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return Playlist{}, false, err
+	}
+	playlistId, err := strconv.ParseInt(ctx.Params("playlist_id"), 10, 64)
+	if err != nil {
+		return Playlist{}, false, err
+	}
+
+	var playlist Playlist
+	err = playlistsCollection.FindOne(ctx.UserContext(), bson.D{{"_id", playlistId}}).Decode(&playlist)
+	if err == mongo.ErrNoDocuments {
+		return Playlist{}, false, fiber.NewError(404, "Playlist not found")
+	}
+	if err != nil {
+		return Playlist{}, false, err
+	}
+	if playlist.OwnerId != userId {
+		return Playlist{}, false, fiber.NewError(403, "Only the owner can change this playlist")
+	}
+	return playlist, true, nil
+}
+
+func registerPlaylistRoutes() {
+	app.Post("/playlists/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		var update PlaylistUpdate
+		err = ctx.BodyParser(&update)
+		if err != nil {
+			return err
+		}
+		if update.Name == nil || !validPlaylistName(*update.Name) {
+			return fiber.NewError(400, "Invalid playlist name")
+		}
+
+		playlist := Playlist{
+			Id:        idNode.Generate().Int64(),
+			OwnerId:   userId,
+			Name:      *update.Name,
+			Public:    update.Public != nil && *update.Public,
+			Videos:    []int64{},
+			CreatedAt: time.Now(),
+		}
+		_, err = playlistsCollection.InsertOne(ctx.UserContext(), playlist)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(playlist)
+	})
+	app.Get("/playlists/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		filter := bson.D{{"owner_id", userId}}
+		if viewerId(ctx) != userId {
+			filter = append(filter, bson.E{Key: "public", Value: true})
+		}
+		filter, findOptions, err := paginate(ctx, filter)
+		if err != nil {
+			return err
+		}
+		cursor, err := playlistsCollection.Find(ctx.UserContext(), filter, findOptions)
+		if err != nil {
+			return err
+		}
+		playlists := make([]Playlist, 0)
+		err = cursor.All(ctx.UserContext(), &playlists)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(playlists)
+	})
+	app.Get("/playlist/:playlist_id", func(ctx *fiber.Ctx) error {
+		playlistId, err := strconv.ParseInt(ctx.Params("playlist_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		var playlist Playlist
+		err = playlistsCollection.FindOne(ctx.UserContext(), bson.D{{"_id", playlistId}}).Decode(&playlist)
+		if err == mongo.ErrNoDocuments || (err == nil && !playlist.Public && viewerId(ctx) != playlist.OwnerId) {
+			return fiber.NewError(404, "Playlist not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		videos, err := getVideosInOrder(ctx.UserContext(), playlist.Videos)
+		if err != nil {
+			return err
+		}
+		videos = viewableVideos(ctx, viewerId(ctx), videos)
+		err = withCreatorVerification(videos)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(PlaylistResponse{Playlist: playlist, VideoDetails: videos})
+	})
+	app.Patch("/playlist/:playlist_id/:user_id", func(ctx *fiber.Ctx) error {
+		playlist, ok, err := getOwnedPlaylist(ctx)
+		if !ok {
+			return err
+		}
+		var update PlaylistUpdate
+		err = ctx.BodyParser(&update)
+		if err != nil {
+			return err
+		}
+
+		changes := bson.D{}
+		if update.Name != nil {
+			if !validPlaylistName(*update.Name) {
+				return fiber.NewError(400, "Invalid playlist name")
+			}
+			changes = append(changes, bson.E{Key: "name", Value: *update.Name})
+		}
+		if update.Public != nil {
+			changes = append(changes, bson.E{Key: "public", Value: *update.Public})
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		_, err = playlistsCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", playlist.Id}}, bson.D{{"$set", changes}})
+		return err
+	})
+	app.Delete("/playlist/:playlist_id/:user_id", func(ctx *fiber.Ctx) error {
+		playlist, ok, err := getOwnedPlaylist(ctx)
+		if !ok {
+			return err
+		}
+		_, err = playlistsCollection.DeleteOne(ctx.UserContext(), bson.D{{"_id", playlist.Id}})
+		return err
+	})
+	app.Post("/playlist/:playlist_id/:user_id/videos/:video_id", func(ctx *fiber.Ctx) error {
+		playlist, ok, err := getOwnedPlaylist(ctx)
+		if !ok {
+			return err
+		}
+		videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		_, err = getVideo(ctx.UserContext(), videoId)
+		if err != nil {
+			return err
+		}
+
+		_, err = playlistsCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", playlist.Id}}, bson.D{{"$addToSet", bson.D{{"videos", videoId}}}})
+		return err
+	})
+	app.Delete("/playlist/:playlist_id/:user_id/videos/:video_id", func(ctx *fiber.Ctx) error {
+		playlist, ok, err := getOwnedPlaylist(ctx)
+		if !ok {
+			return err
+		}
+		videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		_, err = playlistsCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", playlist.Id}}, bson.D{{"$pull", bson.D{{"videos", videoId}}}})
+		return err
+	})
+	app.Put("/playlist/:playlist_id/:user_id/order", func(ctx *fiber.Ctx) error {
+		playlist, ok, err := getOwnedPlaylist(ctx)
+		if !ok {
+			return err
+		}
+		var update PlaylistUpdate
+		err = ctx.BodyParser(&update)
+		if err != nil {
+			return err
+		}
+		if !sameVideos(playlist.Videos, update.Videos) {
+			return fiber.NewError(400, "Order must contain exactly the playlist's videos")
+		}
+
+		// Only reorder if nobody changed the playlist in the meantime
+		filter := bson.D{{"_id", playlist.Id}, {"videos", playlist.Videos}}
+		result, err := playlistsCollection.UpdateOne(ctx.UserContext(), filter, bson.D{{"$set", bson.D{{"videos", update.Videos}}}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return fiber.NewError(409, "Playlist changed while reordering")
+		}
+		return nil
+	})
+}
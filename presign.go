@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Storage keys of direct uploads are s3://bucket/key
+const directUploadPrefix = "s3://"
+
+var (
+	s3Client *s3.S3
+
+	errUploadTooLarge = errors.New("uploaded file is too large")
+)
+
+// PendingUpload is a presigned upload the client hasn't finalized yet
+type PendingUpload struct {
+	Id        int64     `bson:"_id" json:"upload_id"`
+	UserId    int64     `bson:"user_id" json:"-"`
+	Key       string    `bson:"key" json:"-"`
+	Url       string    `bson:"-" json:"url"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// Direct uploads are only available when an s3 compatible bucket is configured
+func initDirectUploads() {
+	if config.s3Bucket == "" {
+		return
+	}
+	awsConfig := &aws.Config{Region: aws.String(config.s3Region)}
+	if config.s3Endpoint != "" {
+		awsConfig.Endpoint = aws.String(config.s3Endpoint)
+		awsConfig.S3ForcePathStyle = aws.Bool(true)
+	}
+	s3Client = s3.New(session.Must(session.NewSession(awsConfig)))
+}
+
+func presignUpload(ctx *fiber.Ctx) error {
+	if s3Client == nil {
+		return fiber.NewError(501, "Direct uploads are not configured")
+	}
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	id := idNode.Generate().Int64()
+	pending := PendingUpload{
+		Id:        id,
+		UserId:    userId,
+		Key:       fmt.Sprintf("uploads/%d/%d", userId, id),
+		ExpiresAt: time.Now().Add(config.presignExpiry),
+	}
+	request, _ := s3Client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(config.s3Bucket),
+		Key:    aws.String(pending.Key),
+	})
+	pending.Url, err = request.Presign(config.presignExpiry)
+	if err != nil {
+		return err
+	}
+	_, err = pendingUploadsCollection.InsertOne(ctx.UserContext(), pending)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(pending)
+}
+
+// Checks the stored object is a video within the size limit, matching the checksum when one is given
+func validateStoredObject(key string, expectedSha256 string) (int64, error) {
+	head, err := s3Client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(config.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	size := aws.Int64Value(head.ContentLength)
+	if size > config.uploadMaxBytes {
+		return size, errUploadTooLarge
+	}
+
+	object, err := s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(config.s3Bucket),
+		Key:    aws.String(key),
+		Range:  aws.String("bytes=0-511"),
+	})
+	if err != nil {
+		return size, err
+	}
+	defer object.Body.Close()
+	header, err := ioutil.ReadAll(object.Body)
+	if err != nil {
+		return size, err
+	}
+	if !isVideoContent(header) {
+		return size, errNotAVideo
+	}
+	if expectedSha256 == "" {
+		return size, nil
+	}
+
+	object, err = s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(config.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return size, err
+	}
+	defer object.Body.Close()
+	return size, verifyChecksum(object.Body, expectedSha256)
+}
+
+func readDirectUpload(storageKey string) (io.ReadCloser, error) {
+	if s3Client == nil {
+		return nil, errNoPortals
+	}
+	location := strings.SplitN(strings.TrimPrefix(storageKey, directUploadPrefix), "/", 2)
+	if len(location) != 2 {
+		return nil, fmt.Errorf("invalid storage key %s", storageKey)
+	}
+	object, err := s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(location[0]),
+		Key:    aws.String(location[1]),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return object.Body, nil
+}
+
+func deleteDirectUpload(storageKey string) error {
+	if s3Client == nil {
+		return errNoPortals
+	}
+	location := strings.SplitN(strings.TrimPrefix(storageKey, directUploadPrefix), "/", 2)
+	if len(location) != 2 {
+		return fmt.Errorf("invalid storage key %s", storageKey)
+	}
+	_, err := s3Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(location[0]),
+		Key:    aws.String(location[1]),
+	})
+	return err
+}
+
+func finalizeUpload(ctx *fiber.Ctx) error {
+	if s3Client == nil {
+		return fiber.NewError(501, "Direct uploads are not configured")
+	}
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	uploadId, err := strconv.ParseInt(ctx.Params("upload_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var upload VideoUpload
+	err = ctx.BodyParser(&upload)
+	if err != nil {
+		return err
+	}
+
+	var pending PendingUpload
+	err = pendingUploadsCollection.FindOne(ctx.UserContext(), bson.D{{"_id", uploadId}, {"user_id", userId}}).Decode(&pending)
+	if err == mongo.ErrNoDocuments || (err == nil && pending.ExpiresAt.Before(time.Now())) {
+		return fiber.NewError(404, "Upload not found or expired")
+	}
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	err = validateUpload(ctx, userId, upload)
+	if err == nil {
+		size, err = validateStoredObject(pending.Key, upload.Sha256)
+	}
+	if isUploadError(err) || err == errUploadTooLarge {
+		_, deleteErr := s3Client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(config.s3Bucket),
+			Key:    aws.String(pending.Key),
+		})
+		if deleteErr != nil {
+			log.Print(deleteErr)
+		}
+		return fiber.NewError(400, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	video, err := createVideo(pending.Id, userId, upload, directUploadPrefix+config.s3Bucket+"/"+pending.Key, size)
+	if isUploadError(err) {
+		return fiber.NewError(400, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	_, err = pendingUploadsCollection.DeleteOne(ctx.UserContext(), bson.D{{"_id", pending.Id}})
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(video)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Positions this close to the end count as finished
+const finishedThresholdMs = 2000
+
+type WatchProgress struct {
+	PositionMs int64 `json:"position_ms"`
+	DurationMs int64 `json:"duration_ms"`
+	// Any id the client keeps per device, sessions on different devices are counted apart
+	DeviceId string `json:"device_id"`
+}
+
+type PlaybackPosition struct {
+	UserId     int64     `bson:"user_id" json:"-"`
+	VideoId    int64     `bson:"video_id" json:"video_id"`
+	PositionMs int64     `bson:"position_ms" json:"position_ms"`
+	DurationMs int64     `bson:"duration_ms" json:"duration_ms"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type ResumeEntry struct {
+	Video      Video `json:"video"`
+	PositionMs int64 `json:"position_ms"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+func (progress WatchProgress) finished() bool {
+	return progress.DurationMs > 0 && progress.DurationMs-progress.PositionMs <= finishedThresholdMs
+}
+
+func savePlaybackPosition(userId int64, videoId int64, progress WatchProgress) error {
+	filter := bson.D{{"user_id", userId}, {"video_id", videoId}}
+	if progress.finished() {
+		_, err := playbackPositionsCollection.DeleteOne(mctx, filter)
+		return err
+	}
+
+	update := bson.D{{"$set", PlaybackPosition{
+		UserId:     userId,
+		VideoId:    videoId,
+		PositionMs: progress.PositionMs,
+		DurationMs: progress.DurationMs,
+		UpdatedAt:  time.Now(),
+	}}}
+	_, err := playbackPositionsCollection.UpdateOne(mctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func registerProgressRoutes() {
+	app.Post("/progress/:video_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		video, ok, err := getViewableVideo(ctx, userId)
+		if !ok {
+			return err
+		}
+		videoId := video.Id
+		var progress WatchProgress
+		err = ctx.BodyParser(&progress)
+		if err != nil {
+			return err
+		}
+		if progress.PositionMs < 0 || progress.DurationMs < 0 {
+			return fiber.NewError(400, "Invalid playback position")
+		}
+
+		err = savePlaybackPosition(userId, videoId, progress)
+		if err != nil {
+			return err
+		}
+		err = recordWatchSession(userId, videoId, progress)
+		if err != nil {
+			return err
+		}
+		return recordQuartiles(userId, videoId, progress)
+	})
+	app.Get("/resume/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		findOptions := options.Find().SetSort(bson.D{{"updated_at", -1}}).SetLimit(defaultPageSize)
+		cursor, err := playbackPositionsCollection.Find(ctx.UserContext(), bson.D{{"user_id", userId}}, findOptions)
+		if err != nil {
+			return err
+		}
+		var positions []PlaybackPosition
+		err = cursor.All(ctx.UserContext(), &positions)
+		if err != nil {
+			return err
+		}
+
+		videoIds := make([]int64, len(positions))
+		for i, position := range positions {
+			videoIds[i] = position.VideoId
+		}
+		videos, err := getVideosInOrder(ctx.UserContext(), videoIds)
+		if err != nil {
+			return err
+		}
+		err = withCreatorVerification(videos)
+		if err != nil {
+			return err
+		}
+		byId := make(map[int64]Video)
+		for _, video := range viewableVideos(ctx, userId, videos) {
+			byId[video.Id] = video
+		}
+
+		entries := make([]ResumeEntry, 0, len(positions))
+		for _, position := range positions {
+			video, exists := byId[position.VideoId]
+			if !exists {
+				continue
+			}
+			entries = append(entries, ResumeEntry{
+				Video:      video,
+				PositionMs: position.PositionMs,
+				DurationMs: position.DurationMs,
+			})
+		}
+		return ctx.JSON(entries)
+	})
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxQueryRange   = 366 * 24 * time.Hour
+	maxQueryRows    = 1000
+	maxFilterValues = 100
+)
+
+// Ad-hoc report over one kind of event, only the fields listed below can be used
+type AnalyticsQuery struct {
+	Source     string        `json:"source"`
+	Metrics    []string      `json:"metrics"`
+	Dimensions []string      `json:"dimensions"`
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Filters    []QueryFilter `json:"filters"`
+	Limit      int64         `json:"limit"`
+}
+
+// Matches events where the field is any of the values
+type QueryFilter struct {
+	Field  string   `json:"field"`
+	Values []string `json:"values"`
+}
+
+type querySource struct {
+	hot  *mongo.Collection
+	cold *mongo.Collection
+	// Like and watch events of resident users are in their regional database
+	resident bool
+	// Extra metrics and dimensions on top of the ones every source has
+	metrics    map[string]bool
+	dimensions map[string]bool
+}
+
+func querySources() map[string]querySource {
+	return map[string]querySource{
+		"watches": {
+			hot:      watchedVideosCollection,
+			cold:     watchedVideosArchiveCollection,
+			resident: true,
+			metrics:  map[string]bool{"watch_time_ms": true, "avg_completion": true},
+		},
+		"likes": {
+			hot:      likedVideosCollection,
+			cold:     likedVideosArchiveCollection,
+			resident: true,
+		},
+		"dislikes": {hot: dislikedVideosCollection},
+		"saves":    {hot: savedVideosCollection},
+		"comments": {hot: commentsCollection},
+		"shares": {
+			hot:        sharesCollection,
+			dimensions: map[string]bool{"platform": true},
+		},
+	}
+}
+
+var (
+	queryMetrics = map[string]bool{"count": true, "users": true}
+	// Time buckets are in UTC, weeks are ISO weeks
+	queryTimeDimensions = map[string]string{
+		"day":   "%Y-%m-%d",
+		"week":  "%G-W%V",
+		"month": "%Y-%m",
+	}
+	queryDimensions = map[string]bool{"video_id": true, "creator_id": true}
+	// Filterable fields and whether their values are ids
+	queryFilterFields = map[string]bool{"video_id": true, "user_id": true, "creator_id": true, "platform": false}
+)
+
+// Returns why the query can't be run, or an empty string
+func validateAnalyticsQuery(query AnalyticsQuery) string {
+	source, ok := querySources()[query.Source]
+	if !ok {
+		return "Unknown source " + query.Source
+	}
+	if len(query.Metrics) == 0 {
+		return "At least one metric is required"
+	}
+	seen := make(map[string]bool)
+	for _, metric := range query.Metrics {
+		if !queryMetrics[metric] && !source.metrics[metric] {
+			return "Unknown metric " + metric + " for " + query.Source
+		}
+		if seen[metric] {
+			return "Duplicate metric " + metric
+		}
+		seen[metric] = true
+	}
+	timeDimensions := 0
+	for _, dimension := range query.Dimensions {
+		_, isTime := queryTimeDimensions[dimension]
+		if !isTime && !queryDimensions[dimension] && !source.dimensions[dimension] {
+			return "Unknown dimension " + dimension + " for " + query.Source
+		}
+		if seen[dimension] {
+			return "Duplicate dimension " + dimension
+		}
+		seen[dimension] = true
+		if isTime {
+			timeDimensions++
+		}
+	}
+	if timeDimensions > 1 {
+		return "Only one of day, week and month can be used"
+	}
+	if query.From.IsZero() || query.To.IsZero() || !query.From.Before(query.To) {
+		return "A date range with from before to is required"
+	}
+	if query.To.Sub(query.From) > maxQueryRange {
+		return "Date range can be at most 366 days"
+	}
+	for _, filter := range query.Filters {
+		isId, ok := queryFilterFields[filter.Field]
+		if !ok || (filter.Field == "platform" && !source.dimensions["platform"]) {
+			return "Unknown filter " + filter.Field + " for " + query.Source
+		}
+		if len(filter.Values) == 0 || len(filter.Values) > maxFilterValues {
+			return "Filters need between 1 and " + strconv.Itoa(maxFilterValues) + " values"
+		}
+		if isId {
+			for _, value := range filter.Values {
+				if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+					return "Invalid id " + value + " for " + filter.Field
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func queryFilterValues(filter QueryFilter) bson.A {
+	values := make(bson.A, len(filter.Values))
+	for i, value := range filter.Values {
+		if queryFilterFields[filter.Field] {
+			values[i], _ = strconv.ParseInt(value, 10, 64)
+		} else {
+			values[i] = value
+		}
+	}
+	return values
+}
+
+// Partial results of one database, only turned into metrics once the groups of every database are merged
+type queryGroup struct {
+	Dimensions      bson.M  `bson:"_id"`
+	Count           float64 `bson:"count"`
+	Users           []int64 `bson:"users"`
+	WatchTimeMs     int64   `bson:"watch_time_ms"`
+	CompletionSum   float64 `bson:"completion_sum"`
+	CompletionCount int64   `bson:"completion_count"`
+}
+
+// Translates a validated query, field names never come from the request. Events only know their video, so a creator
+// filter comes in as the creators' videos and a creator dimension groups by video, for creators to be looked up after.
+func analyticsPipeline(query AnalyticsQuery, creatorVideos bson.A) mongo.Pipeline {
+	source := querySources()[query.Source]
+
+	match := bson.D{{"time", bson.D{{"$gte", query.From}, {"$lt", query.To}}}}
+	if query.Source == "watches" {
+		match = append(match, countedWatchFilter())
+	}
+	for _, filter := range query.Filters {
+		if filter.Field != "creator_id" {
+			match = append(match, bson.E{Key: filter.Field, Value: bson.D{{"$in", queryFilterValues(filter)}}})
+		}
+	}
+	if creatorVideos != nil {
+		// Under $and as there may be a video_id filter too
+		match = append(match, bson.E{Key: "$and", Value: bson.A{bson.D{{"video_id", bson.D{{"$in", creatorVideos}}}}}})
+	}
+
+	groupId := bson.D{}
+	for _, dimension := range query.Dimensions {
+		if format, ok := queryTimeDimensions[dimension]; ok {
+			groupId = append(groupId, bson.E{Key: dimension, Value: bson.D{{"$dateToString", bson.D{{"format", format}, {"date", "$time"}}}}})
+		} else if dimension != "creator_id" {
+			groupId = append(groupId, bson.E{Key: dimension, Value: "$" + dimension})
+		}
+	}
+	if containsString(query.Dimensions, "creator_id") && !containsString(query.Dimensions, "video_id") {
+		groupId = append(groupId, bson.E{Key: "video_id", Value: "$video_id"})
+	}
+
+	count := bson.D{{"$sum", 1}}
+	if query.Source == "watches" {
+		count = bson.D{{"$sum", watchWeightExpression()}}
+	}
+	group := bson.D{{"_id", groupId}, {"count", count}}
+	for _, metric := range query.Metrics {
+		switch metric {
+		case "users":
+			group = append(group, bson.E{Key: "users", Value: bson.D{{"$addToSet", "$user_id"}}})
+		case "watch_time_ms":
+			group = append(group, bson.E{Key: "watch_time_ms", Value: bson.D{{"$sum", "$watch_duration_ms"}}})
+		case "avg_completion":
+			isNumber := bson.D{{"$in", bson.A{bson.D{{"$type", "$completion_percent"}}, bson.A{"double", "int", "long", "decimal"}}}}
+			group = append(group,
+				bson.E{Key: "completion_sum", Value: bson.D{{"$sum", "$completion_percent"}}},
+				bson.E{Key: "completion_count", Value: bson.D{{"$sum", bson.D{{"$cond", bson.A{isNumber, 1, 0}}}}}},
+			)
+		}
+	}
+
+	pipeline := mongo.Pipeline{{{"$match", match}}, {{"$group", group}}}
+	if source.cold != nil {
+		pipeline = withArchivedEvents(pipeline, source.cold)
+	}
+	return pipeline
+}
+
+// Runs the query in every database holding the source's events and merges the groups, which the limit applies to
+func runAnalyticsQuery(query AnalyticsQuery) ([]bson.M, error) {
+	source := querySources()[query.Source]
+
+	var creatorVideos bson.A
+	for _, filter := range query.Filters {
+		if filter.Field != "creator_id" {
+			continue
+		}
+		videoIds, err := videosCollection.Distinct(mctx, "_id", bson.D{{"creator_id", bson.D{{"$in", queryFilterValues(filter)}}}})
+		if err != nil {
+			return nil, err
+		}
+		creatorVideos = append(bson.A{}, videoIds...)
+	}
+	pipeline := analyticsPipeline(query, creatorVideos)
+
+	databases := []string{""}
+	if source.resident {
+		databases = residencies()
+	}
+	groups := make([]queryGroup, 0)
+	for _, residency := range databases {
+		cursor, err := residentCollection(residency, source.hot).Aggregate(mctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+		if err != nil {
+			return nil, err
+		}
+		var results []queryGroup
+		err = cursor.All(mctx, &results)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, results...)
+	}
+
+	creators := make(map[int64]int64)
+	if containsString(query.Dimensions, "creator_id") {
+		videoIds := make(bson.A, 0, len(groups))
+		for _, group := range groups {
+			videoIds = append(videoIds, group.Dimensions["video_id"])
+		}
+		cursor, err := videosCollection.Find(mctx, bson.D{{"_id", bson.D{{"$in", videoIds}}}}, options.Find().SetProjection(bson.D{{"creator_id", 1}}))
+		if err != nil {
+			return nil, err
+		}
+		var videos []Video
+		err = cursor.All(mctx, &videos)
+		if err != nil {
+			return nil, err
+		}
+		for _, video := range videos {
+			creators[video.Id] = video.CreatorId
+		}
+	}
+
+	type mergedGroup struct {
+		dimensions bson.M
+		queryGroup
+		users map[int64]bool
+	}
+	merged := make(map[string]*mergedGroup)
+	order := make([]string, 0)
+	for _, group := range groups {
+		dimensions := bson.M{}
+		key := ""
+		for _, dimension := range query.Dimensions {
+			value := group.Dimensions[dimension]
+			if dimension == "creator_id" {
+				videoId, _ := group.Dimensions["video_id"].(int64)
+				creatorId, exists := creators[videoId]
+				if !exists {
+					// Events of deleted videos, which a lookup would have dropped too
+					dimensions = nil
+					break
+				}
+				value = creatorId
+			}
+			dimensions[dimension] = value
+			key += fmt.Sprintf("%v\x00", value)
+		}
+		if dimensions == nil {
+			continue
+		}
+		total, exists := merged[key]
+		if !exists {
+			total = &mergedGroup{dimensions: dimensions, users: make(map[int64]bool)}
+			merged[key] = total
+			order = append(order, key)
+		}
+		total.Count += group.Count
+		total.WatchTimeMs += group.WatchTimeMs
+		total.CompletionSum += group.CompletionSum
+		total.CompletionCount += group.CompletionCount
+		for _, userId := range group.Users {
+			total.users[userId] = true
+		}
+	}
+
+	rows := make([]bson.M, 0, len(order))
+	for _, key := range order {
+		total := merged[key]
+		row := total.dimensions
+		for _, metric := range query.Metrics {
+			switch metric {
+			case "count":
+				if query.Source == "watches" {
+					row["count"] = total.Count
+				} else {
+					row["count"] = int64(total.Count)
+				}
+			case "users":
+				row["users"] = int64(len(total.users))
+			case "watch_time_ms":
+				row["watch_time_ms"] = total.WatchTimeMs
+			case "avg_completion":
+				row["avg_completion"] = nil
+				if total.CompletionCount > 0 {
+					row["avg_completion"] = total.CompletionSum / float64(total.CompletionCount)
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	// Time buckets in order, then the first metric largest first
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, dimension := range query.Dimensions {
+			if _, isTime := queryTimeDimensions[dimension]; isTime {
+				first, _ := rows[i][dimension].(string)
+				second, _ := rows[j][dimension].(string)
+				if first != second {
+					return first < second
+				}
+			}
+		}
+		return queryMetricValue(rows[i][query.Metrics[0]]) > queryMetricValue(rows[j][query.Metrics[0]])
+	})
+	limit := query.Limit
+	if limit <= 0 || limit > maxQueryRows {
+		limit = maxQueryRows
+	}
+	if int64(len(rows)) > limit {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+func queryMetricValue(value interface{}) float64 {
+	switch number := value.(type) {
+	case int64:
+		return float64(number)
+	case float64:
+		return number
+	}
+	return 0
+}
+
+func queryAnalytics(ctx *fiber.Ctx) error {
+	var query AnalyticsQuery
+	err := ctx.BodyParser(&query)
+	if err != nil {
+		return err
+	}
+	query.Source = strings.ToLower(query.Source)
+
+	if message := validateAnalyticsQuery(query); message != "" {
+		return fiber.NewError(400, message)
+	}
+
+	rows, err := runAnalyticsQuery(query)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(rows)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const rateLimitSweepInterval = 10 * time.Minute
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Buckets per action and user, a bucket holds up to the limit and refills over the period
+var (
+	rateLimitBuckets     = make(map[string]*tokenBucket)
+	rateLimitBucketsLock sync.Mutex
+)
+
+// Refilled buckets are dropped, they are the same as a missing one
+func startRateLimitSweep() {
+	every(rateLimitSweepInterval, func() {
+		// Untouched for longer than either period, so refilled whichever limit it belongs to
+		cutoff := time.Now().Add(-config.likeRatePeriod - config.uploadRatePeriod)
+		rateLimitBucketsLock.Lock()
+		for key, bucket := range rateLimitBuckets {
+			if bucket.updated.Before(cutoff) {
+				delete(rateLimitBuckets, key)
+			}
+		}
+		rateLimitBucketsLock.Unlock()
+	})
+}
+
+// Takes a token from the user's bucket, or returns how long until one is available
+func takeToken(key string, limit int64, period time.Duration) (bool, time.Duration) {
+	now := time.Now()
+	refillRate := float64(limit) / period.Seconds()
+
+	rateLimitBucketsLock.Lock()
+	defer rateLimitBucketsLock.Unlock()
+	bucket, exists := rateLimitBuckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(limit), updated: now}
+		rateLimitBuckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(limit), bucket.tokens+now.Sub(bucket.updated).Seconds()*refillRate)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / refillRate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// Limits how often each user in the path can take the action, a limit of 0 disables it
+func rateLimit(action string, limit int64, period time.Duration) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if limit <= 0 || period <= 0 {
+			return ctx.Next()
+		}
+		allowed, retryAfter := takeToken(action+" "+ctx.Params("user_id"), limit, period)
+		if !allowed {
+			ctx.Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+			return fiber.NewError(429, "Too many requests")
+		}
+		return ctx.Next()
+	}
+}
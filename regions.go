@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type RegionsUpdate struct {
+	// When set, the video is only available in these countries
+	AllowedCountries []string `json:"allowed_countries"`
+	BlockedCountries []string `json:"blocked_countries"`
+	Reason           string   `json:"reason"`
+}
+
+// ISO 3166-1 alpha-2 country of the viewer, set by the edge
+func viewerCountry(ctx *fiber.Ctx) string {
+	return strings.ToUpper(ctx.Get(config.regionHeader))
+}
+
+// Viewers in an unknown country can't see videos limited to an allow list
+func availableIn(video Video, country string) bool {
+	for _, blocked := range video.BlockedCountries {
+		if blocked == country {
+			return false
+		}
+	}
+	if len(video.AllowedCountries) == 0 {
+		return true
+	}
+	for _, allowed := range video.AllowedCountries {
+		if allowed == country {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter for videos available in the viewer's country, the counterpart of availableIn. Listings put their own
+// $or and $and in filters, so the allow list is checked with a $nor: not limited to countries without this one.
+func regionFilter(country string) bson.D {
+	return bson.D{
+		{"blocked_countries", bson.D{{"$ne", country}}},
+		{"$nor", bson.A{bson.D{
+			{"allowed_countries.0", bson.D{{"$exists", true}}},
+			{"allowed_countries", bson.D{{"$ne", country}}},
+		}}},
+	}
+}
+
+func normalizeCountries(countries []string) []string {
+	normalized := make([]string, 0, len(countries))
+	for _, country := range countries {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if len(country) == 2 {
+			normalized = append(normalized, country)
+		}
+	}
+	return normalized
+}
+
+func updateRegions(videoId int64, update RegionsUpdate) error {
+	_, err := videosCollection.UpdateOne(mctx, bson.D{{"_id", videoId}}, bson.D{{"$set", bson.D{
+		{"allowed_countries", normalizeCountries(update.AllowedCountries)},
+		{"blocked_countries", normalizeCountries(update.BlockedCountries)},
+	}}})
+	return err
+}
+
+// Creators can restrict their own videos
+func setRegions(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var update RegionsUpdate
+	err = ctx.BodyParser(&update)
+	if err != nil {
+		return err
+	}
+
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err != nil {
+		return err
+	}
+	if video.CreatorId != userId {
+		return fiber.NewError(403, "Only the creator can change this video")
+	}
+
+	return updateRegions(videoId, update)
+}
+
+// Moderators can restrict any video
+func adminSetRegions(ctx *fiber.Ctx) error {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var update RegionsUpdate
+	err = ctx.BodyParser(&update)
+	if err != nil {
+		return err
+	}
+
+	err = updateRegions(videoId, update)
+	if err != nil {
+		return err
+	}
+	return recordAudit(adminId(ctx), "set_regions", "video", ctx.Params("video_id"), update.Reason)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	remixDuet   = "duet"
+	remixStitch = "stitch"
+)
+
+var errInvalidSourceVideo = errors.New("invalid source video")
+
+// Checks the video a duet/stitch is based on and records its lineage
+func withRemixSource(video Video) (Video, error) {
+	if video.SourceVideoId == 0 {
+		return video, nil
+	}
+	if video.RemixType != remixDuet && video.RemixType != remixStitch {
+		return Video{}, errInvalidSourceVideo
+	}
+	source, err := getVideo(mctx, video.SourceVideoId)
+	if err != nil {
+		return Video{}, errInvalidSourceVideo
+	}
+	if source.TakenDown || !source.Public || (source.CreatorId != video.CreatorId && !source.allowsRemix(video.RemixType)) {
+		return Video{}, errInvalidSourceVideo
+	}
+	video.Lineage = append(append([]int64{}, source.Lineage...), source.Id)
+	return video, nil
+}
+
+func getRemixes(ctx *fiber.Ctx) error {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	blocks, err := viewerBlockFilter(ctx)
+	if err != nil {
+		return err
+	}
+	filter := append(bson.D{{"source_video_id", videoId}, {"public", true}, {"taken_down", bson.D{{"$ne", true}}}}, blocks...)
+	filter = append(filter, regionFilter(viewerCountry(ctx))...)
+	filter, findOptions, err := paginateVideos(ctx, filter)
+	if err != nil {
+		return err
+	}
+	cursor, err := videosCollection.Find(ctx.UserContext(), filter, findOptions)
+	if err != nil {
+		return err
+	}
+	remixes := make([]Video, 0)
+	err = cursor.All(ctx.UserContext(), &remixes)
+	if err != nil {
+		return err
+	}
+	return sendVideos(ctx, remixes)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errForbiddenAddress = errors.New("remote address is not allowed")
+	errRemoteTooLarge   = errors.New("remote file is too large")
+	errInvalidRemoteUrl = errors.New("invalid remote url")
+)
+
+var privateNetworks = parseNetworks("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+func isPublicIp(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks every address actually connected to, so redirects and dns rebinding can't reach internal services
+var remoteClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network string, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || !isPublicIp(ip) {
+					return errForbiddenAddress
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errInvalidRemoteUrl
+		}
+		if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+			return errInvalidRemoteUrl
+		}
+		return nil
+	},
+}
+
+// Downloads a remote file into a temporary file, which the caller has to remove
+func downloadRemote(rawUrl string) (*os.File, error) {
+	remoteUrl, err := url.Parse(rawUrl)
+	if err != nil || (remoteUrl.Scheme != "http" && remoteUrl.Scheme != "https") || remoteUrl.Host == "" {
+		return nil, errInvalidRemoteUrl
+	}
+
+	requestCtx, cancel := context.WithTimeout(context.Background(), config.remoteUploadTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(requestCtx, "GET", remoteUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := remoteClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		return nil, errInvalidRemoteUrl
+	}
+	if response.ContentLength > config.uploadMaxBytes {
+		return nil, errRemoteTooLarge
+	}
+
+	file, err := ioutil.TempFile("", "remote-upload-")
+	if err != nil {
+		return nil, err
+	}
+	written, err := io.Copy(file, io.LimitReader(response.Body, config.uploadMaxBytes+1))
+	if err == nil && written > config.uploadMaxBytes {
+		err = errRemoteTooLarge
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+func uploadFromUrl(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var upload VideoUpload
+	err = ctx.BodyParser(&upload)
+	if err != nil {
+		return err
+	}
+	err = validateUpload(ctx, userId, upload)
+	if isUploadError(err) {
+		return fiber.NewError(400, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	_, downloadSpan := tracer.Start(ctx.UserContext(), "download remote video", trace.WithSpanKind(trace.SpanKindClient))
+	file, err := downloadRemote(ctx.FormValue("url"))
+	finishSpan(downloadSpan, err)
+	if err == errInvalidRemoteUrl || err == errRemoteTooLarge || errors.Is(err, errForbiddenAddress) {
+		return fiber.NewError(400, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	video, err := processUpload(ctx.UserContext(), userId, upload, file)
+	if isUploadError(err) {
+		return fiber.NewError(400, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(video)
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const replayBatchSize = 500
+
+// A downstream service that can be sent a replay of past events
+type ReplayConsumer struct {
+	Name      string    `bson:"_id" json:"name"`
+	Url       string    `bson:"url" json:"url"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+type ReplayConsumerUpdate struct {
+	Url    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// The stored event as is, discounted watches included, so consumers can apply their own rules
+type ReplayEvent struct {
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	Event bson.M    `json:"event"`
+}
+
+type replaySource struct {
+	Type       string
+	Collection func() *mongo.Collection
+	// Like and watch events of resident users are in their regional database
+	Resident bool
+}
+
+var replaySources = []replaySource{
+	{Type: "like", Collection: func() *mongo.Collection { return likedVideosCollection }, Resident: true},
+	{Type: "like", Collection: func() *mongo.Collection { return likedVideosArchiveCollection }, Resident: true},
+	{Type: "watch", Collection: func() *mongo.Collection { return watchedVideosCollection }, Resident: true},
+	{Type: "watch", Collection: func() *mongo.Collection { return watchedVideosArchiveCollection }, Resident: true},
+	{Type: "comment", Collection: func() *mongo.Collection { return commentsCollection }},
+	{Type: "save", Collection: func() *mongo.Collection { return savedVideosCollection }},
+	{Type: "share", Collection: func() *mongo.Collection { return sharesCollection }},
+	{Type: "dislike", Collection: func() *mongo.Collection { return dislikedVideosCollection }},
+}
+
+func registerReplayRoutes(admin fiber.Router) {
+	admin.Get("/replay", streamReplay)
+	admin.Get("/replay/consumers", func(ctx *fiber.Ctx) error {
+		cursor, err := replayConsumersCollection.Find(ctx.UserContext(), bson.D{})
+		if err != nil {
+			return err
+		}
+		consumers := make([]ReplayConsumer, 0)
+		err = cursor.All(ctx.UserContext(), &consumers)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(consumers)
+	})
+	admin.Put("/replay/consumers/:name", func(ctx *fiber.Ctx) error {
+		var update ReplayConsumerUpdate
+		err := ctx.BodyParser(&update)
+		if err != nil {
+			return err
+		}
+		if update.Url == "" {
+			return fiber.NewError(400, "Missing url")
+		}
+
+		consumer := ReplayConsumer{Name: ctx.Params("name"), Url: update.Url, CreatedAt: time.Now()}
+		_, err = replayConsumersCollection.ReplaceOne(ctx.UserContext(), bson.D{{"_id", consumer.Name}}, consumer, options.Replace().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+		return recordAudit(adminId(ctx), "replay_consumer_register", "replay_consumer", consumer.Name, update.Reason)
+	})
+	admin.Delete("/replay/consumers/:name", func(ctx *fiber.Ctx) error {
+		var action ModerationAction
+		err := ctx.BodyParser(&action)
+		if err != nil {
+			return err
+		}
+
+		_, err = replayConsumersCollection.DeleteOne(ctx.UserContext(), bson.D{{"_id", ctx.Params("name")}})
+		if err != nil {
+			return err
+		}
+		return recordAudit(adminId(ctx), "replay_consumer_remove", "replay_consumer", ctx.Params("name"), action.Reason)
+	})
+	admin.Post("/replay/consumers/:name/start", startReplay)
+}
+
+// Since and until bound the replay, until defaults to now so a replay doesn't chase new events
+func replayTimeRange(ctx *fiber.Ctx) (bson.D, error) {
+	timeRange, err := queryTimeRange(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Query("until") == "" {
+		timeRange = append(timeRange, bson.E{Key: "$lt", Value: time.Now()})
+	}
+	return timeRange, nil
+}
+
+// Every kind of event in the range merged into one stream in time order. Aggregations can't union collections of
+// regional databases, so every database is read in time order on its own and the streams are merged here.
+func replayEvents(timeRange bson.D) (*replayStream, error) {
+	stream := &replayStream{}
+	for _, residency := range residencies() {
+		sources := make([]replaySource, 0, len(replaySources))
+		for _, source := range replaySources {
+			if residency == "" || source.Resident {
+				sources = append(sources, source)
+			}
+		}
+		cursor, err := replayDatabaseEvents(residency, sources, timeRange)
+		if err != nil {
+			stream.close()
+			return nil, err
+		}
+		stream.cursors = append(stream.cursors, cursor)
+	}
+	return stream, nil
+}
+
+func replayDatabaseEvents(residency string, sources []replaySource, timeRange bson.D) (*mongo.Cursor, error) {
+	// Events stored before they had a time take it from their ObjectId
+	match := bson.D{{"$match", bson.D{{"$or", bson.A{
+		bson.D{{"time", timeRange}},
+		bson.D{{"time", bson.D{{"$exists", false}}}},
+	}}}}}
+	eventTime := bson.D{{"$ifNull", bson.A{"$time", bson.D{{"$toDate", "$_id"}}}}}
+	sourceStages := func(source replaySource) mongo.Pipeline {
+		return mongo.Pipeline{
+			match,
+			{{"$project", bson.D{{"_id", 0}, {"type", bson.D{{"$literal", source.Type}}}, {"time", eventTime}, {"event", "$$ROOT"}}}},
+			{{"$match", bson.D{{"time", timeRange}}}},
+		}
+	}
+
+	pipeline := sourceStages(sources[0])
+	for _, source := range sources[1:] {
+		pipeline = append(pipeline, bson.D{{"$unionWith", bson.D{
+			{"coll", source.Collection().Name()},
+			{"pipeline", sourceStages(source)},
+		}}})
+	}
+	pipeline = append(pipeline, bson.D{{"$sort", bson.D{{"time", 1}, {"event._id", 1}}}})
+	return residentCollection(residency, sources[0].Collection()).Aggregate(mctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+}
+
+// Merges the time ordered events of every database
+type replayStream struct {
+	cursors []*mongo.Cursor
+	// The next event of every cursor, nil once it's exhausted
+	heads []*ReplayEvent
+}
+
+// The earliest event not returned yet, false once there are none left
+func (stream *replayStream) next() (ReplayEvent, bool, error) {
+	if stream.heads == nil {
+		stream.heads = make([]*ReplayEvent, len(stream.cursors))
+		for i := range stream.cursors {
+			err := stream.advance(i)
+			if err != nil {
+				return ReplayEvent{}, false, err
+			}
+		}
+	}
+	earliest := -1
+	for i, head := range stream.heads {
+		if head != nil && (earliest == -1 || head.Time.Before(stream.heads[earliest].Time)) {
+			earliest = i
+		}
+	}
+	if earliest == -1 {
+		return ReplayEvent{}, false, nil
+	}
+	event := *stream.heads[earliest]
+	return event, true, stream.advance(earliest)
+}
+
+func (stream *replayStream) advance(i int) error {
+	stream.heads[i] = nil
+	cursor := stream.cursors[i]
+	if !cursor.Next(mctx) {
+		return cursor.Err()
+	}
+	var event ReplayEvent
+	err := cursor.Decode(&event)
+	if err != nil {
+		return err
+	}
+	stream.heads[i] = &event
+	return nil
+}
+
+func (stream *replayStream) close() {
+	for _, cursor := range stream.cursors {
+		cursor.Close(mctx)
+	}
+}
+
+// Streams the replay as newline delimited json, for consumers that would rather pull
+func streamReplay(ctx *fiber.Ctx) error {
+	timeRange, err := replayTimeRange(ctx)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		err := writeReplay(writer, timeRange)
+		if err != nil {
+			log.Print(err)
+		}
+		writer.CloseWithError(err)
+	}()
+
+	ctx.Type("application/x-ndjson")
+	return ctx.SendStream(reader)
+}
+
+func writeReplay(writer io.Writer, timeRange bson.D) error {
+	stream, err := replayEvents(timeRange)
+	if err != nil {
+		return err
+	}
+	defer stream.close()
+
+	buffered := bufio.NewWriter(writer)
+	encoder := json.NewEncoder(buffered)
+	for {
+		event, ok, err := stream.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return buffered.Flush()
+		}
+		err = encoder.Encode(event)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Posts the replay to a registered consumer in batches, in the background as replays can take hours
+func startReplay(ctx *fiber.Ctx) error {
+	var action ModerationAction
+	err := ctx.BodyParser(&action)
+	if err != nil {
+		return err
+	}
+	var consumer ReplayConsumer
+	err = replayConsumersCollection.FindOne(ctx.UserContext(), bson.D{{"_id", ctx.Params("name")}}).Decode(&consumer)
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(404, "Consumer not found")
+	}
+	if err != nil {
+		return err
+	}
+	timeRange, err := replayTimeRange(ctx)
+	if err != nil {
+		return err
+	}
+
+	background(func() {
+		sent, err := sendReplay(consumer, timeRange)
+		if err != nil {
+			log.Printf("Replay to %s stopped after %d events: %s", consumer.Name, sent, err)
+			return
+		}
+		log.Printf("Replayed %d events to %s", sent, consumer.Name)
+	})
+
+	err = recordAudit(adminId(ctx), "replay", "replay_consumer", consumer.Name, action.Reason)
+	if err != nil {
+		return err
+	}
+	return ctx.SendStatus(202)
+}
+
+func sendReplay(consumer ReplayConsumer, timeRange bson.D) (int64, error) {
+	stream, err := replayEvents(timeRange)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.close()
+
+	var sent int64
+	batch := make([]ReplayEvent, 0, replayBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := postWebhookWithRetries(consumer.Url, batch, config.webhookAttempts)
+		if err != nil {
+			return err
+		}
+		sent += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		event, ok, err := stream.next()
+		if err != nil {
+			return sent, err
+		}
+		if !ok {
+			return sent, flush()
+		}
+		batch = append(batch, event)
+		if len(batch) == replayBatchSize {
+			if shuttingDown() {
+				return sent, errShuttingDown
+			}
+			err = flush()
+			if err != nil {
+				return sent, err
+			}
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const reportCheckInterval = time.Hour
+
+type ReportSubscription struct {
+	UserId     int64     `bson:"_id" json:"user_id"`
+	Email      string    `bson:"email" json:"email"`
+	LastSentAt time.Time `bson:"last_sent_at" json:"last_sent_at"`
+}
+
+type WeeklyReport struct {
+	Since      time.Time
+	Until      time.Time
+	Watches    int64
+	Likes      int64
+	Comments   int64
+	Shares     int64
+	TopVideo   *Video
+	TopWatches int64
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`Your week on Blue, {{.Since.Format "Jan 2"}} to {{.Until.Format "Jan 2"}}
+
+Watches:  {{.Watches}}
+Likes:    {{.Likes}}
+Comments: {{.Comments}}
+Shares:   {{.Shares}}
+{{if .TopVideo}}
+Your top video was "{{.TopVideo.Description}}" with {{.TopWatches}} watches.
+{{end}}
+You can unsubscribe from these reports in the app.
+`))
+
+func startReports() {
+	if config.smtpAddr == "" {
+		return
+	}
+	every(reportCheckInterval, func() {
+		err := sendDueReports(time.Now())
+		if err != nil {
+			log.Print(err)
+		}
+	})
+}
+
+// Every replica runs this, so each subscription is claimed by moving last_sent_at before its report is sent and only
+// the replica whose claim matched sends it. A report that fails is handed back for the next run.
+func sendDueReports(now time.Time) error {
+	due := bson.D{{"last_sent_at", bson.D{{"$lte", now.Add(-week)}}}}
+	cursor, err := reportSubscriptionsCollection.Find(mctx, due, options.Find().SetProjection(bson.D{{"_id", 1}}))
+	if err != nil {
+		return err
+	}
+	var subscriptions []ReportSubscription
+	err = cursor.All(mctx, &subscriptions)
+	if err != nil {
+		return err
+	}
+
+	for _, candidate := range subscriptions {
+		var subscription ReportSubscription
+		err = reportSubscriptionsCollection.FindOneAndUpdate(mctx,
+			append(bson.D{{"_id", candidate.UserId}}, due...),
+			bson.D{{"$set", bson.D{{"last_sent_at", now}}}},
+		).Decode(&subscription)
+		if err == mongo.ErrNoDocuments {
+			// Claimed by another replica
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		report, err := buildWeeklyReport(subscription.UserId, now.Add(-week), now)
+		if err == nil {
+			err = sendReport(subscription.Email, report)
+		}
+		if err != nil {
+			log.Printf("Failed to send report to %d: %s", subscription.UserId, err)
+			_, err = reportSubscriptionsCollection.UpdateOne(mctx,
+				bson.D{{"_id", subscription.UserId}, {"last_sent_at", now}},
+				bson.D{{"$set", bson.D{{"last_sent_at", subscription.LastSentAt}}}},
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func buildWeeklyReport(userId int64, since time.Time, until time.Time) (WeeklyReport, error) {
+	report := WeeklyReport{Since: since, Until: until}
+	results, err := videosCollection.Distinct(mctx, "_id", bson.D{creatorFilter(userId)})
+	if err != nil {
+		return report, err
+	}
+	if len(results) == 0 {
+		return report, nil
+	}
+	timeRange := bson.D{{"$gte", since}, {"$lt", until}}
+	filter := bson.D{{"video_id", bson.D{{"$in", results}}}, {"time", timeRange}}
+
+	type counted struct {
+		collection *mongo.Collection
+		count      *int64
+	}
+	counts := []counted{
+		{commentsCollection, &report.Comments},
+		{sharesCollection, &report.Shares},
+	}
+	// Likes of resident users are kept in their region
+	for _, residency := range residencies() {
+		liked, likedArchive, _, _ := residentEvents(residency)
+		counts = append(counts, counted{liked, &report.Likes}, counted{likedArchive, &report.Likes})
+	}
+	for _, counted := range counts {
+		count, err := counted.collection.CountDocuments(mctx, filter)
+		if err != nil {
+			return report, err
+		}
+		*counted.count += count
+	}
+
+	pipeline := mongo.Pipeline{
+		{{"$match", append(filter, countedWatchFilter())}},
+		{{"$group", bson.D{{"_id", "$video_id"}, {"watches", bson.D{{"$sum", watchWeightExpression()}}}}}},
+	}
+	watches := make(map[int64]float64)
+	for _, residency := range residencies() {
+		_, _, watched, watchedArchive := residentEvents(residency)
+		cursor, err := watched.Aggregate(mctx, withArchivedEvents(pipeline, watchedArchive))
+		if err != nil {
+			return report, err
+		}
+		var videos []struct {
+			VideoId int64   `bson:"_id"`
+			Watches float64 `bson:"watches"`
+		}
+		err = cursor.All(mctx, &videos)
+		if err != nil {
+			return report, err
+		}
+		for _, video := range videos {
+			watches[video.VideoId] += video.Watches
+		}
+	}
+	var topVideoId int64
+	var total float64
+	for videoId, videoWatches := range watches {
+		total += videoWatches
+		if topVideoId == 0 || videoWatches > watches[topVideoId] {
+			topVideoId = videoId
+		}
+	}
+	report.Watches = int64(total)
+	if topVideoId != 0 {
+		topVideo, err := getVideo(mctx, topVideoId)
+		if err != nil {
+			return report, err
+		}
+		report.TopVideo = &topVideo
+		report.TopWatches = int64(watches[topVideoId])
+	}
+	return report, nil
+}
+
+func sendReport(email string, report WeeklyReport) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\nTo: %s\r\nSubject: Your weekly analytics\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n", config.emailFrom, email)
+	err := reportTemplate.Execute(&body, report)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if config.smtpUsername != "" {
+		host, _, err := net.SplitHostPort(config.smtpAddr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", config.smtpUsername, config.smtpPassword, host)
+	}
+	return smtp.SendMail(config.smtpAddr, auth, config.emailFrom, []string{email}, body.Bytes())
+}
+
+func registerReportRoutes() {
+	app.Post("/reports/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		var subscription ReportSubscription
+		err = ctx.BodyParser(&subscription)
+		if err != nil {
+			return err
+		}
+		address, err := mail.ParseAddress(subscription.Email)
+		if err != nil {
+			return fiber.NewError(400, "Invalid email address")
+		}
+
+		// The first report goes out a week after subscribing
+		_, err = reportSubscriptionsCollection.UpdateOne(ctx.UserContext(),
+			bson.D{{"_id", userId}},
+			bson.D{
+				{"$set", bson.D{{"email", address.Address}}},
+				{"$setOnInsert", bson.D{{"last_sent_at", time.Now()}}},
+			},
+			options.Update().SetUpsert(true),
+		)
+		return err
+	})
+	app.Delete("/reports/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		_, err = reportSubscriptionsCollection.DeleteOne(ctx.UserContext(), bson.D{{"_id", userId}})
+		return err
+	})
+}
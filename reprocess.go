@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	reprocessQueued  = "queued"
+	reprocessRunning = "running"
+	reprocessDone    = "done"
+	reprocessFailed  = "failed"
+)
+
+// Thumbnails and renditions are made by the media pipeline, which is asked to redo them through its webhook
+var reprocessSteps = []string{"thumbnails", "transcoding", "captions", "moderation"}
+
+var errPipelineNotConfigured = errors.New("media pipeline webhook is not configured")
+
+type ReprocessJob struct {
+	Id          int64           `bson:"_id" json:"id"`
+	VideoId     int64           `bson:"video_id" json:"video_id"`
+	Steps       []ReprocessStep `bson:"steps" json:"steps"`
+	Status      string          `bson:"status" json:"status"`
+	RequestedBy int64           `bson:"requested_by" json:"requested_by"`
+	Reason      string          `bson:"reason" json:"reason"`
+	CreatedAt   time.Time       `bson:"created_at" json:"created_at"`
+	FinishedAt  *time.Time      `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+type ReprocessStep struct {
+	Name   string `bson:"name" json:"name"`
+	Status string `bson:"status" json:"status"`
+	Error  string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+type ReprocessRequest struct {
+	// All steps when empty
+	Steps  []string `json:"steps"`
+	Reason string   `json:"reason"`
+}
+
+// What the media pipeline is sent. It puts each new rendition through /internal/video/:video_id/renditions/:quality
+// and reports the steps of the job back through /internal/video/:video_id/renditions once they're done.
+type MediaPipelineRequest struct {
+	JobId      int64    `json:"job_id"`
+	VideoId    int64    `json:"video_id"`
+	StorageKey string   `json:"storage_key"`
+	Steps      []string `json:"steps"`
+}
+
+// The pipeline's report on the steps it was sent, they all failed when there's an error
+type MediaPipelineReport struct {
+	JobId int64    `json:"job_id"`
+	Steps []string `json:"steps"`
+	Error string   `json:"error"`
+}
+
+func reprocessVideo(ctx *fiber.Ctx) error {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var request ReprocessRequest
+	err = ctx.BodyParser(&request)
+	if err != nil {
+		return err
+	}
+	if len(request.Steps) == 0 {
+		request.Steps = reprocessSteps
+	}
+	steps := make([]ReprocessStep, 0, len(request.Steps))
+	for _, name := range request.Steps {
+		if !containsString(reprocessSteps, name) {
+			return fiber.NewError(400, "Unknown step "+name)
+		}
+		steps = append(steps, ReprocessStep{Name: name, Status: reprocessQueued})
+	}
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err != nil {
+		return err
+	}
+
+	job := ReprocessJob{
+		Id:          idNode.Generate().Int64(),
+		VideoId:     videoId,
+		Steps:       steps,
+		Status:      reprocessQueued,
+		RequestedBy: adminId(ctx),
+		Reason:      request.Reason,
+		CreatedAt:   time.Now(),
+	}
+	_, err = reprocessJobsCollection.InsertOne(ctx.UserContext(), job)
+	if err != nil {
+		return err
+	}
+	err = recordAudit(adminId(ctx), "reprocess", "video", ctx.Params("video_id"), request.Reason)
+	if err != nil {
+		return err
+	}
+
+	background(func() {
+		runReprocessJob(job, video)
+	})
+	_ = ctx.Status(202)
+	return ctx.JSON(job)
+}
+
+func runReprocessJob(job ReprocessJob, video Video) {
+	setReprocessStatus(job.Id, bson.D{{"status", reprocessRunning}})
+	var pipelineSteps []string
+	for i, step := range job.Steps {
+		var err error
+		switch step.Name {
+		case "thumbnails", "transcoding":
+			// Sent together once the steps that run here are done
+			pipelineSteps = append(pipelineSteps, step.Name)
+			continue
+		case "captions":
+			err = requestCaptions(video)
+		case "moderation":
+			err = remoderateVideo(video)
+		}
+		recordReprocessStep(job.Id, i, err)
+	}
+
+	if len(pipelineSteps) > 0 {
+		// Running before they're sent, the pipeline can report back before the post returns. Accepted steps
+		// keep running until it does.
+		running := bson.D{}
+		for i, step := range job.Steps {
+			if containsString(pipelineSteps, step.Name) {
+				running = append(running, bson.E{Key: "steps." + strconv.Itoa(i) + ".status", Value: reprocessRunning})
+			}
+		}
+		setReprocessStatus(job.Id, running)
+
+		err := errPipelineNotConfigured
+		if config.mediaPipelineWebhook != "" {
+			err = postWebhookWithRetries(config.mediaPipelineWebhook, MediaPipelineRequest{
+				JobId:      job.Id,
+				VideoId:    video.Id,
+				StorageKey: video.StorageKey,
+				Steps:      pipelineSteps,
+			}, config.webhookAttempts)
+		}
+		if err != nil {
+			for i, step := range job.Steps {
+				if containsString(pipelineSteps, step.Name) {
+					recordReprocessStep(job.Id, i, err)
+				}
+			}
+		}
+	}
+
+	err := finishReprocessJob(job.Id)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Finishes the job once none of its steps are queued or running. Both the job itself and the pipeline's report
+// call this after recording their steps, so whichever records last finishes it.
+func finishReprocessJob(jobId int64) error {
+	var job ReprocessJob
+	err := reprocessJobsCollection.FindOne(mctx, bson.D{{"_id", jobId}}).Decode(&job)
+	if err != nil {
+		return err
+	}
+	status := reprocessDone
+	for _, step := range job.Steps {
+		switch step.Status {
+		case reprocessQueued, reprocessRunning:
+			return nil
+		case reprocessFailed:
+			status = reprocessFailed
+		}
+	}
+	_, err = reprocessJobsCollection.UpdateOne(mctx,
+		bson.D{{"_id", jobId}, {"status", reprocessRunning}},
+		bson.D{{"$set", bson.D{{"status", status}, {"finished_at", time.Now()}}}},
+	)
+	return err
+}
+
+// Called by the media pipeline once it's done with the steps of a reprocess job
+func reportRenditions(ctx *fiber.Ctx) error {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var report MediaPipelineReport
+	err = ctx.BodyParser(&report)
+	if err != nil {
+		return err
+	}
+	var job ReprocessJob
+	err = reprocessJobsCollection.FindOne(ctx.UserContext(), bson.D{{"_id", report.JobId}, {"video_id", videoId}}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(404, "Job not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	var stepErr error
+	if report.Error != "" {
+		stepErr = errors.New(report.Error)
+	}
+	for i, step := range job.Steps {
+		if step.Status == reprocessRunning && containsString(report.Steps, step.Name) {
+			recordReprocessStep(job.Id, i, stepErr)
+		}
+	}
+	return finishReprocessJob(job.Id)
+}
+
+func recordReprocessStep(jobId int64, index int, err error) {
+	prefix := "steps." + strconv.Itoa(index) + "."
+	if err != nil {
+		log.Printf("Reprocess job %d step %d failed: %s", jobId, index, err)
+		setReprocessStatus(jobId, bson.D{{prefix + "status", reprocessFailed}, {prefix + "error", err.Error()}})
+		return
+	}
+	setReprocessStatus(jobId, bson.D{{prefix + "status", reprocessDone}})
+}
+
+func setReprocessStatus(jobId int64, fields bson.D) {
+	_, err := reprocessJobsCollection.UpdateOne(mctx, bson.D{{"_id", jobId}}, bson.D{{"$set", fields}})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Holds the video when its description no longer passes, releasing is left to a moderator
+func remoderateVideo(video Video) error {
+	if video.HeldForReview || !shouldHoldDescription(video.Description, video.Language) {
+		return nil
+	}
+	_, err := videosCollection.UpdateOne(mctx, bson.D{{"_id", video.Id}}, bson.D{{"$set", bson.D{{"held_for_review", true}, {"public", false}}}})
+	if err != nil {
+		return err
+	}
+	syncSearchIndex(video.Id)
+	return nil
+}
+
+func getReprocessJob(ctx *fiber.Ctx) error {
+	jobId, err := strconv.ParseInt(ctx.Params("job_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var job ReprocessJob
+	err = reprocessJobsCollection.FindOne(ctx.UserContext(), bson.D{{"_id", jobId}}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(404, "Job not found")
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(job)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Databases keeping the like and watch events of users resident in a region, by residency
+var regionalDatabases = make(map[string]*mongo.Database)
+
+// Connects the databases from residency_mongo_uris, a comma separated list of residency=uri
+func initResidency() {
+	if config.residencyMongoUris == "" {
+		return
+	}
+	for _, entry := range strings.Split(config.residencyMongoUris, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			log.Fatalf("Invalid residency database %s, expected residency=uri", entry)
+		}
+		regionalClient, err := mongo.NewClient(options.Client().ApplyURI(parts[1]).SetMonitor(mongoMonitor()))
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = regionalClient.Connect(mctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		regionalDatabases[strings.ToLower(parts[0])] = regionalClient.Database(config.mongoDatabase)
+	}
+}
+
+// Errors are returned rather than falling back to the home database, which would put events where they don't belong
+func userResidency(ctx context.Context, userId int64) (string, error) {
+	if len(regionalDatabases) == 0 {
+		return "", nil
+	}
+	var user User
+	err := usersCollection.FindOne(ctx, bson.D{{"_id", userId}}, options.FindOne().SetProjection(bson.D{{"residency", 1}})).Decode(&user)
+	if err != nil {
+		return "", err
+	}
+	return user.Residency, nil
+}
+
+// Every residency with its own events, "" being the home database. Jobs over all events have to go through each,
+// as aggregations can't reach across databases.
+func residencies() []string {
+	all := []string{""}
+	for residency := range regionalDatabases {
+		all = append(all, residency)
+	}
+	return all
+}
+
+// Names the residency's database in logs
+func databaseLabel(residency string) string {
+	if residency == "" {
+		return "home"
+	}
+	return residency
+}
+
+// The collection in the user's regional database, or the collection itself for users without one
+func residentCollection(residency string, collection *mongo.Collection) *mongo.Collection {
+	database, exists := regionalDatabases[strings.ToLower(residency)]
+	if !exists {
+		return collection
+	}
+	return database.Collection(collection.Name())
+}
+
+// Like and watch collections holding the user's events, hot and archived
+func residentEvents(residency string) (liked, likedArchive, watched, watchedArchive *mongo.Collection) {
+	return residentCollection(residency, likedVideosCollection),
+		residentCollection(residency, likedVideosArchiveCollection),
+		residentCollection(residency, watchedVideosCollection),
+		residentCollection(residency, watchedVideosArchiveCollection)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Quartile 0 marks a viewer that started playback
+var quartiles = []int64{0, 25, 50, 75, 100}
+
+type QuartileRetention struct {
+	Quartile int64   `json:"quartile"`
+	Viewers  int64   `json:"viewers"`
+	Rate     float64 `json:"rate"`
+}
+
+func reachedQuartile(progress WatchProgress) int64 {
+	if progress.finished() {
+		return 100
+	}
+	if progress.DurationMs <= 0 {
+		return 0
+	}
+	return progress.PositionMs * 100 / progress.DurationMs / 25 * 25
+}
+
+// Records every quartile up to the one reached, once per viewer
+func recordQuartiles(userId int64, videoId int64, progress WatchProgress) error {
+	reached := reachedQuartile(progress)
+	writes := make([]mongo.WriteModel, 0, len(quartiles))
+	for _, quartile := range quartiles {
+		if quartile > reached {
+			break
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{"user_id", userId}, {"video_id", videoId}, {"quartile", quartile}}).
+			SetUpdate(bson.D{{"$setOnInsert", bson.D{{"time", time.Now()}}}}).
+			SetUpsert(true))
+	}
+	_, err := quartileEventsCollection.BulkWrite(mctx, writes)
+	return err
+}
+
+func getRetentionCurve(ctx *fiber.Ctx) error {
+	video, ok, err := getOwnedVideo(ctx)
+	if !ok {
+		return err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.D{{"video_id", video.Id}}}},
+		{{"$group", bson.D{{"_id", "$quartile"}, {"viewers", bson.D{{"$sum", 1}}}}}},
+	}
+	cursor, err := quartileEventsCollection.Aggregate(ctx.UserContext(), pipeline)
+	if err != nil {
+		return err
+	}
+	var counts []struct {
+		Quartile int64 `bson:"_id"`
+		Viewers  int64 `bson:"viewers"`
+	}
+	err = cursor.All(ctx.UserContext(), &counts)
+	if err != nil {
+		return err
+	}
+	viewers := make(map[int64]int64)
+	for _, count := range counts {
+		viewers[count.Quartile] = count.Viewers
+	}
+
+	curve := make([]QuartileRetention, len(quartiles))
+	for i, quartile := range quartiles {
+		curve[i] = QuartileRetention{Quartile: quartile, Viewers: viewers[quartile]}
+		if viewers[0] > 0 {
+			curve[i].Rate = float64(viewers[quartile]) / float64(viewers[0])
+		}
+	}
+	return ctx.JSON(curve)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"math/rand"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// How many watches the stored event stands for, 0 when the watch isn't sampled and only marks that the user watched.
+// Only videos past the sampling threshold are sampled, everything else is always stored with a weight of 1.
+func sampleWatch(video Video) float64 {
+	if config.watchSamplingThreshold <= 0 || video.Views < config.watchSamplingThreshold || config.watchSamplingRate >= 1 {
+		return 1
+	}
+	if rand.Float64() >= config.watchSamplingRate {
+		return 0
+	}
+	return 1 / config.watchSamplingRate
+}
+
+// Number of watches a stored event stands for, for use in aggregations
+func watchWeightExpression() bson.D {
+	return bson.D{{"$ifNull", bson.A{"$weight", 1}}}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SavedVideo struct {
+	Id      int64     `bson:"_id" json:"id"`
+	VideoId int64     `bson:"video_id" json:"video_id"`
+	UserId  int64     `bson:"user_id" json:"user_id"`
+	Time    time.Time `bson:"time" json:"time"`
+	Video   *Video    `bson:"-" json:"video,omitempty"`
+}
+
+func hasSaved(userId int64, videoId int64) bool {
+	filter := bson.D{{"user_id", userId}, {"video_id", videoId}}
+	var limit int64 = 1
+	documentCount, err := savedVideosCollection.CountDocuments(mctx, filter, &options.CountOptions{
+		Limit: &limit,
+	})
+	if err != nil {
+		return true
+	}
+	return documentCount == int64(1)
+}
+
+func saveVideo(user User, video Video) error {
+	_, err := savedVideosCollection.InsertOne(mctx, SavedVideo{
+		Id:      idNode.Generate().Int64(),
+		VideoId: video.Id,
+		UserId:  user.Id,
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Saving says more about a user than liking does
+	adjustInterests(user, video, config.saveInterestWeight)
+	return nil
+}
+
+func unsaveVideo(user User, video Video) error {
+	result, err := savedVideosCollection.DeleteOne(mctx, bson.D{{"user_id", user.Id}, {"video_id", video.Id}})
+	if err != nil {
+		return err
+	}
+	// Already removed by a concurrent request
+	if result.DeletedCount == 0 {
+		return nil
+	}
+
+	adjustInterests(user, video, -config.saveInterestWeight)
+	return nil
+}
+
+func registerSavedRoutes() {
+	app.Post("/save/:video_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		if hasSaved(userId, videoId) {
+			return duplicateInteraction(ctx, "already_saved", "User has already saved this post")
+		}
+
+		user, err := getUser(ctx.UserContext(), userId)
+		if err != nil {
+			return err
+		}
+		video, err := getVideo(ctx.UserContext(), videoId)
+		if err != nil {
+			return err
+		}
+		if video.TakenDown {
+			return fiber.NewError(410, "Video has been taken down")
+		}
+		if !availableIn(video, viewerCountry(ctx)) {
+			return fiber.NewError(451, "Video is not available in your region")
+		}
+		if !canView(video, userId) {
+			return fiber.NewError(403, "Video is private")
+		}
+		if video.AgeRestricted && !canViewAgeRestricted(user) {
+			return fiber.NewError(403, "Video is age restricted")
+		}
+
+		return saveVideo(user, video)
+	})
+	app.Delete("/save/:video_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		if !hasSaved(userId, videoId) {
+			return duplicateInteraction(ctx, "not_saved", "User has not saved this post")
+		}
+
+		user, err := getUser(ctx.UserContext(), userId)
+		if err != nil {
+			return err
+		}
+		video, err := getVideo(ctx.UserContext(), videoId)
+		if err != nil {
+			return err
+		}
+
+		return unsaveVideo(user, video)
+	})
+	app.Get("/saved/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		filter, findOptions, err := paginate(ctx, bson.D{{"user_id", userId}})
+		if err != nil {
+			return err
+		}
+		cursor, err := savedVideosCollection.Find(ctx.UserContext(), filter, findOptions)
+		if err != nil {
+			return err
+		}
+		saved := make([]SavedVideo, 0)
+		err = cursor.All(ctx.UserContext(), &saved)
+		if err != nil {
+			return err
+		}
+
+		videoIds := make([]int64, len(saved))
+		for i, entry := range saved {
+			videoIds[i] = entry.VideoId
+		}
+		videos, err := getVideosInOrder(ctx.UserContext(), videoIds)
+		if err != nil {
+			return err
+		}
+		byId := make(map[int64]Video)
+		for _, video := range videos {
+			byId[video.Id] = video
+		}
+		for i := range saved {
+			if video, exists := byId[saved[i].VideoId]; exists {
+				saved[i].Video = &video
+			}
+		}
+		return ctx.JSON(saved)
+	})
+}
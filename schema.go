@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/bluemediaapp/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Bson types each kind of field in the shared models can be decoded from
+var compatibleTypes = map[reflect.Kind][]bsontype.Type{
+	reflect.Int64:  {bsontype.Int64, bsontype.Int32},
+	reflect.Uint8:  {bsontype.Int32, bsontype.Int64},
+	reflect.String: {bsontype.String},
+	reflect.Bool:   {bsontype.Boolean},
+	reflect.Slice:  {bsontype.Array, bsontype.Null},
+	reflect.Map:    {bsontype.EmbeddedDocument, bsontype.Null},
+}
+
+// Checks the newest document of every collection shared with other services against the shared models,
+// a renamed or retyped field would otherwise silently decode as its zero value
+func checkSchemas() {
+	if !config.schemaCheck {
+		return
+	}
+	schemas := []struct {
+		collection *mongo.Collection
+		model      interface{}
+	}{
+		{videosCollection, models.DatabaseVideo{}},
+		{usersCollection, models.DatabaseUser{}},
+		{likedVideosCollection, models.DatabaseLikeEvent{}},
+		{watchedVideosCollection, models.DatabaseWatchEvent{}},
+	}
+
+	problems := make([]string, 0)
+	for _, schema := range schemas {
+		document, err := newestDocument(schema.collection)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, problem := range schemaDrift(document, reflect.TypeOf(schema.model)) {
+			problems = append(problems, schema.collection.Name()+": "+problem)
+		}
+	}
+	if len(problems) > 0 {
+		log.Fatalf("Documents don't match the shared models:\n%s", strings.Join(problems, "\n"))
+	}
+}
+
+func newestDocument(collection *mongo.Collection) (bson.Raw, error) {
+	return collection.FindOne(mctx, bson.D{}, options.FindOne().SetSort(bson.D{{"_id", -1}})).DecodeBytes()
+}
+
+func schemaDrift(document bson.Raw, model reflect.Type) []string {
+	problems := make([]string, 0)
+	for i := 0; i < model.NumField(); i++ {
+		field := model.Field(i)
+		tag := strings.Split(field.Tag.Get("bson"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		omitEmpty := false
+		for _, option := range tag[1:] {
+			omitEmpty = omitEmpty || option == "omitempty"
+		}
+
+		value, err := document.LookupErr(name)
+		if err != nil {
+			if !omitEmpty {
+				problems = append(problems, fmt.Sprintf("missing %s", name))
+			}
+			continue
+		}
+		compatible := false
+		for _, valueType := range compatibleTypes[field.Type.Kind()] {
+			compatible = compatible || value.Type == valueType
+		}
+		if !compatible {
+			problems = append(problems, fmt.Sprintf("%s is %s, expected %s", name, value.Type, field.Type))
+		}
+	}
+	return problems
+}
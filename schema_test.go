@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bluemediaapp/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestVideoMatchesSharedModel(t *testing.T) {
+	shared := models.DatabaseVideo{
+		Id:          1,
+		Description: "description",
+		Series:      "series",
+		Public:      true,
+		CreatorId:   2,
+		Likes:       3,
+		Tags:        []string{"tag"},
+		Modifiers:   []string{"modifier"},
+		StorageKey:  "storage",
+	}
+	video := Video{DatabaseVideo: shared, Views: 4, Language: "en"}
+	checkRoundTrip(t, video, &models.DatabaseVideo{}, shared)
+	checkRoundTrip(t, shared, &Video{}, Video{DatabaseVideo: shared})
+}
+
+func TestUserMatchesSharedModel(t *testing.T) {
+	shared := models.DatabaseUser{
+		Id:        1,
+		Username:  "user",
+		Interests: map[string]int64{"tag": 2},
+	}
+	user := User{DatabaseUser: shared, Verified: true, Residency: "eu"}
+	checkRoundTrip(t, user, &models.DatabaseUser{}, shared)
+	checkRoundTrip(t, shared, &User{}, User{DatabaseUser: shared})
+}
+
+func TestLikeEventMatchesSharedModel(t *testing.T) {
+	shared := models.DatabaseLikeEvent{VideoId: 1, UserId: 2}
+	event := LikeEvent{DatabaseLikeEvent: shared, Time: time.Now()}
+	checkRoundTrip(t, event, &models.DatabaseLikeEvent{}, shared)
+	checkRoundTrip(t, shared, &LikeEvent{}, LikeEvent{DatabaseLikeEvent: shared})
+}
+
+func TestWatchEventMatchesSharedModel(t *testing.T) {
+	shared := models.DatabaseWatchEvent{VideoId: 1, UserId: 2}
+	event := WatchEvent{DatabaseWatchEvent: shared, Weight: 1, WatchDurationMs: 3, Time: time.Now()}
+	checkRoundTrip(t, event, &models.DatabaseWatchEvent{}, shared)
+	checkRoundTrip(t, shared, &WatchEvent{}, WatchEvent{DatabaseWatchEvent: shared})
+}
+
+func TestSchemaDriftFindsRenamedAndRetypedFields(t *testing.T) {
+	document, err := bson.Marshal(bson.D{{"video", int64(1)}, {"user_id", "2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := schemaDrift(document, reflect.TypeOf(models.DatabaseWatchEvent{}))
+	expected := []string{"missing video_id", "user_id is string, expected int64"}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("got %q, expected %q", problems, expected)
+	}
+}
+
+// Encodes written, decodes it into read and compares with expected, then checks the document has every field
+// of the shared model
+func checkRoundTrip(t *testing.T, written interface{}, read interface{}, expected interface{}) {
+	t.Helper()
+	document, err := bson.Marshal(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bson.Unmarshal(document, read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := reflect.ValueOf(read).Elem().Interface()
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("%T decoded from %T is %+v, expected %+v", decoded, written, decoded, expected)
+	}
+
+	for _, model := range []interface{}{written, expected} {
+		shared := sharedModel(reflect.TypeOf(model))
+		if problems := schemaDrift(document, shared); len(problems) > 0 {
+			t.Errorf("%T doesn't match %s: %q", written, shared, problems)
+		}
+	}
+}
+
+// The shared model a type embeds, or the type itself when it is one
+func sharedModel(model reflect.Type) reflect.Type {
+	for i := 0; i < model.NumField(); i++ {
+		field := model.Field(i)
+		if field.Anonymous && field.Type.PkgPath() == "github.com/bluemediaapp/models" {
+			return field.Type
+		}
+	}
+	return model
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type searchDocument struct {
+	Description string   `json:"description"`
+	Series      string   `json:"series"`
+	Tags        []string `json:"tags"`
+	CreatorId   int64    `json:"creator_id"`
+	Language    string   `json:"language"`
+	Public      bool     `json:"public"`
+	TakenDown   bool     `json:"taken_down"`
+	Likes       int64    `json:"likes"`
+}
+
+func createTextIndex() {
+	_, err := videosCollection.Indexes().CreateOne(mctx, mongo.IndexModel{
+		Keys: bson.D{{"description", "text"}, {"tags", "text"}, {"series", "text"}},
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func searchRequest(method string, path string, body interface{}) (*http.Response, error) {
+	var payload bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&payload).Encode(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	request, err := http.NewRequest(method, config.elasticsearchUrl+"/"+config.elasticsearchIndex+path, &payload)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 300 && response.StatusCode != 404 {
+		response.Body.Close()
+		return nil, fmt.Errorf("search index responded with %d", response.StatusCode)
+	}
+	return response, nil
+}
+
+// Mirrors the current state of a video into the search index, when one is configured
+func syncSearchIndex(videoId int64) {
+	if config.elasticsearchUrl == "" {
+		return
+	}
+	background(func() {
+		video, err := getVideo(mctx, videoId)
+		if err == mongo.ErrNoDocuments {
+			removeFromSearchIndex(videoId)
+			return
+		}
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		document := searchDocument{
+			Description: video.Description,
+			Series:      video.Series,
+			Tags:        video.Tags,
+			CreatorId:   video.CreatorId,
+			Language:    video.Language,
+			Public:      video.Public,
+			TakenDown:   video.TakenDown,
+			Likes:       video.Likes,
+		}
+		response, err := searchRequest("PUT", "/_doc/"+strconv.FormatInt(videoId, 10), document)
+		if err != nil {
+			log.Printf("Failed to index video %d: %s", videoId, err)
+			return
+		}
+		response.Body.Close()
+	})
+}
+
+func removeFromSearchIndex(videoId int64) {
+	if config.elasticsearchUrl == "" {
+		return
+	}
+	response, err := searchRequest("DELETE", "/_doc/"+strconv.FormatInt(videoId, 10), nil)
+	if err != nil {
+		log.Printf("Failed to remove video %d from the index: %s", videoId, err)
+		return
+	}
+	response.Body.Close()
+}
+
+func searchElasticsearch(query string, limit int64) ([]int64, error) {
+	body := map[string]interface{}{
+		"size":    limit,
+		"_source": false,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":  query,
+						"fields": []string{"description", "tags^2", "series"},
+					},
+				},
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"public": true}},
+					map[string]interface{}{"term": map[string]interface{}{"taken_down": false}},
+				},
+			},
+		},
+	}
+	response, err := searchRequest("POST", "/_search", body)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Id string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	videoIds := make([]int64, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		videoId, err := strconv.ParseInt(hit.Id, 10, 64)
+		if err == nil {
+			videoIds = append(videoIds, videoId)
+		}
+	}
+	return videoIds, nil
+}
+
+// The index only knows whether a video is public, hits it returns are checked against the full viewer filter
+// in mongo. It's asked for this many times the page so filtered hits rarely leave the page short.
+const searchOverfetch = 2
+
+// Search has no user in the path, anonymous viewers get the filter of a user without settings
+func searchViewerFilter(ctx *fiber.Ctx) (bson.D, error) {
+	user := User{}
+	if viewer := viewerId(ctx); viewer != 0 {
+		var err error
+		user, err = getUser(ctx.UserContext(), viewer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return viewerFilter(ctx, user)
+}
+
+// The videos matching the filter, in the order of the ids
+func filterVideosInOrder(ctx context.Context, videoIds []int64, filter bson.D) ([]Video, error) {
+	videos := make([]Video, 0, len(videoIds))
+	if len(videoIds) == 0 {
+		return videos, nil
+	}
+	filter = append(bson.D{{"_id", bson.D{{"$in", videoIds}}}}, filter...)
+	cursor, err := videosCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var found []Video
+	err = cursor.All(ctx, &found)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[int64]Video)
+	for _, video := range found {
+		byId[video.Id] = video
+	}
+	for _, videoId := range videoIds {
+		if video, exists := byId[videoId]; exists {
+			videos = append(videos, video)
+		}
+	}
+	return videos, nil
+}
+
+func searchMongo(ctx context.Context, query string, filter bson.D, limit int64) ([]Video, error) {
+	filter = append(bson.D{{"$text", bson.D{{"$search", query}}}}, filter...)
+	findOptions := options.Find().
+		SetProjection(bson.D{{"score", bson.D{{"$meta", "textScore"}}}}).
+		SetSort(bson.D{{"score", bson.D{{"$meta", "textScore"}}}}).
+		SetLimit(limit)
+	cursor, err := videosCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	videos := make([]Video, 0)
+	err = cursor.All(ctx, &videos)
+	return videos, err
+}
+
+func searchVideos(ctx *fiber.Ctx) error {
+	query := ctx.Query("q")
+	if query == "" {
+		return fiber.NewError(400, "Missing search query")
+	}
+	limit, err := pageLimit(ctx)
+	if err != nil {
+		return err
+	}
+	filter, err := searchViewerFilter(ctx)
+	if err != nil {
+		return err
+	}
+
+	if config.elasticsearchUrl == "" {
+		videos, err := searchMongo(ctx.UserContext(), query, filter, limit)
+		if err != nil {
+			return err
+		}
+		return sendVideos(ctx, videos)
+	}
+
+	videoIds, err := searchElasticsearch(query, limit*searchOverfetch)
+	if err != nil {
+		return err
+	}
+	videos, err := filterVideosInOrder(ctx.UserContext(), videoIds, filter)
+	if err != nil {
+		return err
+	}
+	if int64(len(videos)) > limit {
+		videos = videos[:limit]
+	}
+	return sendVideos(ctx, videos)
+}
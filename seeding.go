@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxSeedTopics = 50
+
+type InterestSeed struct {
+	Topics []string `json:"topics"`
+}
+
+// Topics picked during onboarding map straight to tags
+func topicTag(topic string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(topic), "#"))
+}
+
+func seedInterests(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var seed InterestSeed
+	err = ctx.BodyParser(&seed)
+	if err != nil {
+		return err
+	}
+	if len(seed.Topics) == 0 || len(seed.Topics) > maxSeedTopics {
+		return fiber.NewError(400, "Pick between 1 and "+strconv.Itoa(maxSeedTopics)+" topics")
+	}
+
+	user, err := getUser(ctx.UserContext(), userId)
+	if err != nil {
+		return err
+	}
+
+	// Seeding never overrides interests the user has already built up
+	interests := make(map[string]int64)
+	for _, topic := range seed.Topics {
+		tag := topicTag(topic)
+		if tag == "" {
+			continue
+		}
+		if _, exists := user.Interests[tag]; !exists {
+			interests[tag] = config.interestSeedValue
+		}
+	}
+	modifyInterests(user, interests)
+	return nil
+}
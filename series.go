@@ -0,0 +1,219 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Series group a creator's videos into ordered episodes, member videos carry the series id in their series field
+type Series struct {
+	Id        int64     `bson:"_id" json:"id"`
+	CreatorId int64     `bson:"creator_id" json:"creator_id"`
+	Title     string    `bson:"title" json:"title"`
+	Videos    []int64   `bson:"videos" json:"videos"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+type SeriesUpdate struct {
+	Title  *string `json:"title"`
+	Videos []int64 `json:"videos"`
+}
+
+type SeriesResponse struct {
+	Series
+	Episodes []Video `json:"episodes"`
+}
+
+const maxSeriesTitleLength = 100
+
+func validSeriesTitle(title string) bool {
+	return title != "" && len(title) <= maxSeriesTitleLength
+}
+
+func getSeries(seriesId int64) (Series, error) {
+	var series Series
+	err := seriesCollection.FindOne(mctx, bson.D{{"_id", seriesId}}).Decode(&series)
+	return series, err
+}
+
+// Loads a series for modification, returning ok=false with the error to respond with when the user can't modify it
+func getOwnedSeries(ctx *fiber.Ctx) (Series, bool, error) {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return Series{}, false, err
+	}
+	seriesId, err := strconv.ParseInt(ctx.Params("series_id"), 10, 64)
+	if err != nil {
+		return Series{}, false, err
+	}
+
+	series, err := getSeries(seriesId)
+	if err == mongo.ErrNoDocuments {
+		return Series{}, false, fiber.NewError(404, "Series not found")
+	}
+	if err != nil {
+		return Series{}, false, err
+	}
+	if series.CreatorId != userId {
+		return Series{}, false, fiber.NewError(403, "Only the creator can change this series")
+	}
+	return series, true, nil
+}
+
+func registerSeriesRoutes() {
+	app.Post("/series/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		var update SeriesUpdate
+		err = ctx.BodyParser(&update)
+		if err != nil {
+			return err
+		}
+		if update.Title == nil || !validSeriesTitle(*update.Title) {
+			return fiber.NewError(400, "Invalid series title")
+		}
+
+		series := Series{
+			Id:        idNode.Generate().Int64(),
+			CreatorId: userId,
+			Title:     *update.Title,
+			Videos:    []int64{},
+			CreatedAt: time.Now(),
+		}
+		_, err = seriesCollection.InsertOne(ctx.UserContext(), series)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(SeriesResponse{Series: series, Episodes: []Video{}})
+	})
+	app.Get("/series/:series_id", func(ctx *fiber.Ctx) error {
+		seriesId, err := strconv.ParseInt(ctx.Params("series_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		series, err := getSeries(seriesId)
+		if err == mongo.ErrNoDocuments {
+			return fiber.NewError(404, "Series not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		videos, err := getVideosInOrder(ctx.UserContext(), series.Videos)
+		if err != nil {
+			return err
+		}
+		episodes := viewableVideos(ctx, viewerId(ctx), videos)
+		err = withCreatorVerification(episodes)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(SeriesResponse{Series: series, Episodes: episodes})
+	})
+	app.Patch("/series/:series_id/:user_id", func(ctx *fiber.Ctx) error {
+		series, ok, err := getOwnedSeries(ctx)
+		if !ok {
+			return err
+		}
+		var update SeriesUpdate
+		err = ctx.BodyParser(&update)
+		if err != nil {
+			return err
+		}
+		if update.Title == nil || !validSeriesTitle(*update.Title) {
+			return fiber.NewError(400, "Invalid series title")
+		}
+
+		_, err = seriesCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", series.Id}}, bson.D{{"$set", bson.D{{"title", *update.Title}}}})
+		return err
+	})
+	app.Delete("/series/:series_id/:user_id", func(ctx *fiber.Ctx) error {
+		series, ok, err := getOwnedSeries(ctx)
+		if !ok {
+			return err
+		}
+		_, err = seriesCollection.DeleteOne(ctx.UserContext(), bson.D{{"_id", series.Id}})
+		if err != nil {
+			return err
+		}
+		_, err = videosCollection.UpdateMany(ctx.UserContext(), bson.D{{"series", strconv.FormatInt(series.Id, 10)}}, bson.D{{"$set", bson.D{{"series", ""}}}})
+		return err
+	})
+	app.Post("/series/:series_id/:user_id/videos/:video_id", func(ctx *fiber.Ctx) error {
+		series, ok, err := getOwnedSeries(ctx)
+		if !ok {
+			return err
+		}
+		videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		video, err := getVideo(ctx.UserContext(), videoId)
+		if err != nil {
+			return err
+		}
+		if video.CreatorId != series.CreatorId {
+			return fiber.NewError(403, "Only the creator's own videos can be added")
+		}
+
+		// A video is an episode of one series at most
+		_, err = seriesCollection.UpdateMany(ctx.UserContext(), bson.D{{"videos", videoId}, {"_id", bson.D{{"$ne", series.Id}}}}, bson.D{{"$pull", bson.D{{"videos", videoId}}}})
+		if err != nil {
+			return err
+		}
+		_, err = seriesCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", series.Id}}, bson.D{{"$addToSet", bson.D{{"videos", videoId}}}})
+		if err != nil {
+			return err
+		}
+		_, err = videosCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", videoId}}, bson.D{{"$set", bson.D{{"series", strconv.FormatInt(series.Id, 10)}}}})
+		return err
+	})
+	app.Delete("/series/:series_id/:user_id/videos/:video_id", func(ctx *fiber.Ctx) error {
+		series, ok, err := getOwnedSeries(ctx)
+		if !ok {
+			return err
+		}
+		videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		_, err = seriesCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", series.Id}}, bson.D{{"$pull", bson.D{{"videos", videoId}}}})
+		if err != nil {
+			return err
+		}
+		_, err = videosCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", videoId}, {"series", strconv.FormatInt(series.Id, 10)}}, bson.D{{"$set", bson.D{{"series", ""}}}})
+		return err
+	})
+	app.Put("/series/:series_id/:user_id/order", func(ctx *fiber.Ctx) error {
+		series, ok, err := getOwnedSeries(ctx)
+		if !ok {
+			return err
+		}
+		var update SeriesUpdate
+		err = ctx.BodyParser(&update)
+		if err != nil {
+			return err
+		}
+		if !sameVideos(series.Videos, update.Videos) {
+			return fiber.NewError(400, "Order must contain exactly the series' videos")
+		}
+
+		// Only reorder if nobody changed the series in the meantime
+		filter := bson.D{{"_id", series.Id}, {"videos", series.Videos}}
+		result, err := seriesCollection.UpdateOne(ctx.UserContext(), filter, bson.D{{"$set", bson.D{{"videos", update.Videos}}}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return fiber.NewError(409, "Series changed while reordering")
+		}
+		return nil
+	})
+}
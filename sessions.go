@@ -0,0 +1,104 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Progress events of a viewer on one video and device, with no gap longer than watch_session_gap between them
+type WatchSession struct {
+	UserId      int64     `bson:"user_id" json:"user_id"`
+	VideoId     int64     `bson:"video_id" json:"video_id"`
+	DeviceId    string    `bson:"device_id" json:"device_id"`
+	StartedAt   time.Time `bson:"started_at" json:"started_at"`
+	LastEventAt time.Time `bson:"last_event_at" json:"last_event_at"`
+	Events      int64     `bson:"events" json:"events"`
+	// Furthest position reached during the session
+	PositionMs int64 `bson:"position_ms" json:"position_ms"`
+}
+
+type SessionStats struct {
+	Sessions          int64   `bson:"sessions" json:"sessions"`
+	Viewers           int64   `bson:"viewers" json:"viewers"`
+	AvgSessionMs      float64 `bson:"avg_session_ms" json:"avg_session_ms"`
+	AvgPositionMs     float64 `bson:"avg_position_ms" json:"avg_position_ms"`
+	SessionsPerViewer float64 `bson:"-" json:"sessions_per_viewer"`
+}
+
+func createWatchSessionIndex() {
+	_, err := watchSessionsCollection.Indexes().CreateMany(mctx, []mongo.IndexModel{
+		{Keys: bson.D{{"user_id", 1}, {"video_id", 1}, {"device_id", 1}, {"last_event_at", -1}}},
+		{Keys: bson.D{{"video_id", 1}, {"started_at", 1}}},
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Extends the viewer's latest session on the device when it is still open, otherwise starts a new one
+func recordWatchSession(userId int64, videoId int64, progress WatchProgress) error {
+	now := time.Now()
+	filter := bson.D{
+		{"user_id", userId},
+		{"video_id", videoId},
+		{"device_id", progress.DeviceId},
+		{"last_event_at", bson.D{{"$gte", now.Add(-config.watchSessionGap)}}},
+	}
+	update := bson.D{
+		{"$set", bson.D{{"last_event_at", now}}},
+		{"$setOnInsert", bson.D{{"started_at", now}}},
+		{"$inc", bson.D{{"events", 1}}},
+		{"$max", bson.D{{"position_ms", progress.PositionMs}}},
+	}
+	_, err := watchSessionsCollection.UpdateOne(mctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func getSessionStats(ctx *fiber.Ctx) error {
+	video, ok, err := getOwnedVideo(ctx)
+	if !ok {
+		return err
+	}
+	match := bson.D{{"video_id", video.Id}}
+	timeRange, err := queryTimeRange(ctx)
+	if err != nil {
+		return err
+	}
+	if len(timeRange) > 0 {
+		match = append(match, bson.E{Key: "started_at", Value: timeRange})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{"$match", match}},
+		{{"$group", bson.D{
+			{"_id", nil},
+			{"sessions", bson.D{{"$sum", 1}}},
+			{"viewers", bson.D{{"$addToSet", "$user_id"}}},
+			{"avg_session_ms", bson.D{{"$avg", bson.D{{"$subtract", bson.A{"$last_event_at", "$started_at"}}}}}},
+			{"avg_position_ms", bson.D{{"$avg", "$position_ms"}}},
+		}}},
+		{{"$set", bson.D{{"viewers", bson.D{{"$size", "$viewers"}}}}}},
+	}
+	cursor, err := watchSessionsCollection.Aggregate(ctx.UserContext(), pipeline)
+	if err != nil {
+		return err
+	}
+	var results []SessionStats
+	err = cursor.All(ctx.UserContext(), &results)
+	if err != nil {
+		return err
+	}
+	var stats SessionStats
+	if len(results) > 0 {
+		stats = results[0]
+	}
+	if stats.Viewers > 0 {
+		stats.SessionsPerViewer = float64(stats.Sessions) / float64(stats.Viewers)
+	}
+	return ctx.JSON(stats)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxPlatformLength = 32
+
+type ShareEvent struct {
+	VideoId  int64     `bson:"video_id" json:"video_id"`
+	UserId   int64     `bson:"user_id" json:"user_id"`
+	Platform string    `bson:"platform,omitempty" json:"platform,omitempty"`
+	Time     time.Time `bson:"time" json:"time"`
+}
+
+// Videos can be shared any number of times, only the first share boosts interests
+func shareVideo(user User, video Video, platform string) error {
+	filter := bson.D{{"user_id", user.Id}, {"video_id", video.Id}}
+	var limit int64 = 1
+	previousShares, err := sharesCollection.CountDocuments(mctx, filter, &options.CountOptions{
+		Limit: &limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = sharesCollection.InsertOne(mctx, ShareEvent{
+		VideoId:  video.Id,
+		UserId:   user.Id,
+		Platform: platform,
+		Time:     time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if previousShares == 0 {
+		adjustInterests(user, video, config.shareInterestWeight)
+	}
+	return incrementCounter(video, "shares", 1)
+}
+
+func postShare(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var body struct {
+		Platform string `json:"platform" form:"platform"`
+	}
+	if len(ctx.Body()) > 0 {
+		err = ctx.BodyParser(&body)
+		if err != nil {
+			return err
+		}
+	}
+	platform := strings.ToLower(strings.TrimSpace(body.Platform))
+	if len(platform) > maxPlatformLength {
+		return fiber.NewError(400, "Platform is too long")
+	}
+
+	user, err := getUser(ctx.UserContext(), userId)
+	if err != nil {
+		return err
+	}
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err != nil {
+		return err
+	}
+	if video.TakenDown {
+		return fiber.NewError(410, "Video has been taken down")
+	}
+	if !availableIn(video, viewerCountry(ctx)) {
+		return fiber.NewError(451, "Video is not available in your region")
+	}
+	if !canView(video, userId) {
+		return fiber.NewError(403, "Video is private")
+	}
+	if video.AgeRestricted && !canViewAgeRestricted(user) {
+		return fiber.NewError(403, "Video is age restricted")
+	}
+
+	return shareVideo(user, video, platform)
+}
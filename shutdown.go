@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var errShuttingDown = errors.New("shutting down")
+
+var (
+	// Closed when shutdown starts, background workers stop taking new work
+	stopping = make(chan struct{})
+	// Closed once everything has been drained and mongo is disconnected
+	shutdownComplete = make(chan struct{})
+	workers          sync.WaitGroup
+)
+
+// Runs work in the background, shutdown waits for it like it waits for requests
+func background(work func()) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		work()
+	}()
+}
+
+// Whether shutdown has started, long running work checks this between batches and gives up
+func shuttingDown() bool {
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Runs work every interval until shutdown, a run that already started is finished first
+func every(interval time.Duration, work func()) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopping:
+				return
+			case <-ticker.C:
+				work()
+			}
+		}
+	}()
+}
+
+// On SIGTERM or SIGINT stops accepting requests, then waits for in-flight requests and background work
+// up to the shutdown timeout before disconnecting from mongo
+func shutdownOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	received := <-signals
+	log.Printf("Received %s, shutting down", received)
+
+	close(stopping)
+	drained := make(chan struct{})
+	go func() {
+		err := app.Shutdown()
+		if err != nil {
+			log.Print(err)
+		}
+		workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(config.shutdownTimeout):
+		log.Print("Shutdown timed out with work still in progress")
+	}
+	flushSpans()
+
+	releaseNodeLease()
+	disconnectCtx, cancel := context.WithTimeout(mctx, 5*time.Second)
+	defer cancel()
+	err := client.Disconnect(disconnectCtx)
+	if err != nil {
+		log.Print(err)
+	}
+	for _, database := range regionalDatabases {
+		err = database.Client().Disconnect(disconnectCtx)
+		if err != nil {
+			log.Print(err)
+		}
+	}
+	close(shutdownComplete)
+}
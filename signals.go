@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A kind of interaction exported as a collaborative filtering signal
+type signalSource struct {
+	Type       string
+	Collection func() *mongo.Collection
+	Weight     float64
+	Filter     bson.D
+	// Like and watch events of resident users are in their regional database
+	Resident bool
+}
+
+var signalSources = []signalSource{
+	{Type: "like", Collection: func() *mongo.Collection { return likedVideosCollection }, Weight: 1, Resident: true},
+	{Type: "like", Collection: func() *mongo.Collection { return likedVideosArchiveCollection }, Weight: 1, Resident: true},
+	{Type: "watch", Collection: func() *mongo.Collection { return watchedVideosCollection }, Weight: 0.25, Filter: bson.D{countedWatchFilter()}, Resident: true},
+	{Type: "watch", Collection: func() *mongo.Collection { return watchedVideosArchiveCollection }, Weight: 0.25, Filter: bson.D{countedWatchFilter()}, Resident: true},
+	{Type: "comment", Collection: func() *mongo.Collection { return commentsCollection }, Weight: 1},
+	{Type: "save", Collection: func() *mongo.Collection { return savedVideosCollection }, Weight: 2},
+	{Type: "share", Collection: func() *mongo.Collection { return sharesCollection }, Weight: 1.5},
+	{Type: "dislike", Collection: func() *mongo.Collection { return dislikedVideosCollection }, Weight: -1},
+}
+
+// Signal is a single (user, video, weight) triplet, kept short as exports get large
+type Signal struct {
+	UserId  int64   `json:"u"`
+	VideoId int64   `json:"v"`
+	Weight  float64 `json:"w"`
+	Type    string  `json:"k"`
+	Time    int64   `json:"t"`
+}
+
+// Streams signals between ?since= and ?until= as newline delimited json, until defaults to now
+// and is echoed back in X-Export-Until so the next export can continue from it
+func exportSignals(ctx *fiber.Ctx) error {
+	timeRange, err := queryTimeRange(ctx)
+	if err != nil {
+		return err
+	}
+	until := time.Now()
+	if ctx.Query("until") == "" {
+		timeRange = append(timeRange, bson.E{Key: "$lt", Value: until})
+	} else {
+		until, _ = time.Parse(time.RFC3339, ctx.Query("until"))
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		err := writeSignals(writer, timeRange)
+		if err != nil {
+			log.Print(err)
+		}
+		writer.CloseWithError(err)
+	}()
+
+	ctx.Set("X-Export-Until", until.Format(time.RFC3339))
+	ctx.Type("application/x-ndjson")
+	return ctx.SendStream(reader)
+}
+
+func writeSignals(writer io.Writer, timeRange bson.D) error {
+	buffered := bufio.NewWriter(writer)
+	encoder := json.NewEncoder(buffered)
+	for _, source := range signalSources {
+		databases := []string{""}
+		if source.Resident {
+			databases = residencies()
+		}
+		for _, residency := range databases {
+			err := writeSourceSignals(encoder, source, residentCollection(residency, source.Collection()), timeRange)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return buffered.Flush()
+}
+
+func writeSourceSignals(encoder *json.Encoder, source signalSource, collection *mongo.Collection, timeRange bson.D) error {
+	filter := append(bson.D{{"time", timeRange}}, source.Filter...)
+	cursor, err := collection.Find(mctx, filter, options.Find().SetSort(bson.D{{"time", 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(mctx)
+	for cursor.Next(mctx) {
+		var event struct {
+			UserId  int64     `bson:"user_id"`
+			VideoId int64     `bson:"video_id"`
+			Time    time.Time `bson:"time"`
+			// Set on sampled watch events
+			Weight float64 `bson:"weight"`
+		}
+		err = cursor.Decode(&event)
+		if err != nil {
+			return err
+		}
+		weight := source.Weight
+		if event.Weight > 0 {
+			weight *= event.Weight
+		}
+		err = encoder.Encode(Signal{
+			UserId:  event.UserId,
+			VideoId: event.VideoId,
+			Weight:  weight,
+			Type:    source.Type,
+			Time:    event.Time.Unix(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
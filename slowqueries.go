@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+type startedCommand struct {
+	collection string
+	shape      string
+	// Of the HTTP request the command was run for, empty for background work
+	requestId string
+}
+
+type requestIdKey struct{}
+
+// Puts the request id in the request's context, queries run with ctx.UserContext() carry it to the monitor
+func contextRequestId(ctx *fiber.Ctx) error {
+	requestId, _ := ctx.Locals("requestid").(string)
+	ctx.SetUserContext(context.WithValue(ctx.UserContext(), requestIdKey{}, requestId))
+	return ctx.Next()
+}
+
+var startedCommands sync.Map
+
+// Where each command keeps the part that decides which index is used
+var commandFilters = map[string][]string{
+	"find":          {"filter"},
+	"count":         {"query"},
+	"distinct":      {"query"},
+	"findAndModify": {"query"},
+	"aggregate":     {"pipeline"},
+	"update":        {"updates", "0", "q"},
+	"delete":        {"deletes", "0", "q"},
+}
+
+// Monitors every mongo client is created with. The driver takes a single monitor, so command metrics and
+// tracing are called one after the other.
+func mongoMonitor() *event.CommandMonitor {
+	monitors := []*event.CommandMonitor{slowQueryMonitor()}
+	if tracingEnabled() {
+		monitors = append(monitors, mongoTracingMonitor())
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, started *event.CommandStartedEvent) {
+			for _, monitor := range monitors {
+				monitor.Started(ctx, started)
+			}
+		},
+		Succeeded: func(ctx context.Context, succeeded *event.CommandSucceededEvent) {
+			for _, monitor := range monitors {
+				monitor.Succeeded(ctx, succeeded)
+			}
+		},
+		Failed: func(ctx context.Context, failed *event.CommandFailedEvent) {
+			for _, monitor := range monitors {
+				monitor.Failed(ctx, failed)
+			}
+		},
+	}
+}
+
+// Times every mongo command and logs the ones that take longer than the slow query threshold, when there is one
+func slowQueryMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, started *event.CommandStartedEvent) {
+			path, ok := commandFilters[started.CommandName]
+			if !ok || config.slowQueryThreshold == 0 {
+				return
+			}
+			command := startedCommand{shape: "{}"}
+			command.requestId, _ = ctx.Value(requestIdKey{}).(string)
+			if collection, ok := started.Command.Lookup(started.CommandName).StringValueOK(); ok {
+				command.collection = collection
+			}
+			if filter, err := started.Command.LookupErr(path...); err == nil {
+				command.shape = queryShape(filter)
+			}
+			startedCommands.Store(started.RequestID, command)
+		},
+		Succeeded: func(ctx context.Context, succeeded *event.CommandSucceededEvent) {
+			mongoCommandDuration.observe(ctx, time.Duration(succeeded.DurationNanos).Seconds(), succeeded.CommandName, statusLabel(false))
+			logSlowQuery(succeeded.CommandFinishedEvent)
+		},
+		Failed: func(ctx context.Context, failed *event.CommandFailedEvent) {
+			mongoCommandDuration.observe(ctx, time.Duration(failed.DurationNanos).Seconds(), failed.CommandName, statusLabel(true))
+			logSlowQuery(failed.CommandFinishedEvent)
+		},
+	}
+}
+
+func logSlowQuery(finished event.CommandFinishedEvent) {
+	started, ok := startedCommands.LoadAndDelete(finished.RequestID)
+	if !ok {
+		return
+	}
+	duration := time.Duration(finished.DurationNanos)
+	if duration < config.slowQueryThreshold {
+		return
+	}
+	command := started.(startedCommand)
+	log.Printf("slow query: command=%s collection=%s duration_ms=%d request_id=%s command_id=%d connection_id=%s shape=%s",
+		finished.CommandName, command.collection, duration.Milliseconds(), command.requestId, finished.RequestID, finished.ConnectionID, command.shape)
+}
+
+// Keeps the field names and operators of a filter or pipeline and drops the values
+func queryShape(value bson.RawValue) string {
+	switch value.Type {
+	case bsontype.EmbeddedDocument:
+		elements, err := value.Document().Elements()
+		if err != nil {
+			return "?"
+		}
+		fields := make([]string, len(elements))
+		for i, element := range elements {
+			fields[i] = element.Key() + ":" + queryShape(element.Value())
+		}
+		return "{" + strings.Join(fields, ",") + "}"
+	case bsontype.Array:
+		values, err := value.Array().Values()
+		if err != nil {
+			return "?"
+		}
+		// Pipelines are shaped stage by stage, for $in and friends only the first value matters
+		if len(values) > 0 && values[0].Type == bsontype.EmbeddedDocument {
+			shapes := make([]string, len(values))
+			for i, element := range values {
+				shapes[i] = queryShape(element)
+			}
+			return "[" + strings.Join(shapes, ",") + "]"
+		}
+		return "[?]"
+	default:
+		return "?"
+	}
+}
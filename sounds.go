@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var errInvalidSound = errors.New("invalid sound")
+
+func soundInterestTag(soundId int64) string {
+	return fmt.Sprintf("sound:%d", soundId)
+}
+
+func getSound(soundId int64) (Sound, error) {
+	var sound Sound
+	err := soundsCollection.FindOne(mctx, bson.D{{"_id", soundId}}).Decode(&sound)
+	if err != nil {
+		return Sound{}, err
+	}
+	return sound, nil
+}
+
+// Uses the referenced sound, or registers the video's own audio as a new sound sharing its id
+func withSound(video Video) (Video, error) {
+	if video.SoundId != 0 {
+		result, err := soundsCollection.UpdateOne(mctx, bson.D{{"_id", video.SoundId}}, bson.D{{"$inc", bson.D{{"uses", 1}}}})
+		if err != nil {
+			return Video{}, err
+		}
+		if result.MatchedCount == 0 {
+			return Video{}, errInvalidSound
+		}
+		return video, nil
+	}
+
+	sound := Sound{
+		Id:              video.Id,
+		Title:           "Original sound",
+		CreatorId:       video.CreatorId,
+		OriginalVideoId: video.Id,
+		Uses:            1,
+	}
+	_, err := soundsCollection.InsertOne(mctx, sound)
+	if err != nil {
+		return Video{}, err
+	}
+	video.SoundId = sound.Id
+	return video, nil
+}
+
+// Undoes withSound for a video that couldn't be stored. Videos register their own sound under their id,
+// a referenced sound always has another one.
+func releaseSound(video Video) {
+	var err error
+	if video.SoundId == video.Id {
+		_, err = soundsCollection.DeleteOne(mctx, bson.D{{"_id", video.SoundId}})
+	} else {
+		_, err = soundsCollection.UpdateOne(mctx, bson.D{{"_id", video.SoundId}}, bson.D{{"$inc", bson.D{{"uses", -1}}}})
+	}
+	if err != nil {
+		log.Printf("Failed to release sound %d of video %d: %s", video.SoundId, video.Id, err)
+	}
+}
+
+func getSoundHandler(ctx *fiber.Ctx) error {
+	soundId, err := strconv.ParseInt(ctx.Params("sound_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	sound, err := getSound(soundId)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(sound)
+}
+
+func getSoundVideos(ctx *fiber.Ctx) error {
+	soundId, err := strconv.ParseInt(ctx.Params("sound_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	blocks, err := viewerBlockFilter(ctx)
+	if err != nil {
+		return err
+	}
+	filter := append(bson.D{{"sound_id", soundId}, {"public", true}, {"taken_down", bson.D{{"$ne", true}}}}, blocks...)
+	filter = append(filter, regionFilter(viewerCountry(ctx))...)
+	filter, findOptions, err := paginateVideos(ctx, filter)
+	if err != nil {
+		return err
+	}
+	cursor, err := videosCollection.Find(ctx.UserContext(), filter, findOptions)
+	if err != nil {
+		return err
+	}
+	videos := make([]Video, 0)
+	err = cursor.All(ctx.UserContext(), &videos)
+	if err != nil {
+		return err
+	}
+	return sendVideos(ctx, videos)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var scamPhrases = []string{
+	"free money",
+	"giveaway",
+	"double your",
+	"dm me",
+	"link in bio",
+	"click the link",
+	"whatsapp",
+	"telegram",
+	"crypto",
+	"investment opportunity",
+	"guaranteed profit",
+	"earn $",
+	"cash app",
+	"free followers",
+}
+
+// Scores a description for spam, anything at or above spam_hold_threshold is held for moderation
+func spamScore(description string) float64 {
+	score := 0.0
+	lower := strings.ToLower(description)
+
+	// More than one link is unusual, the same domain over and over even more so
+	links := 0
+	domains := make(map[string]int)
+	for _, word := range strings.Fields(description) {
+		if !strings.Contains(word, "://") && !strings.HasPrefix(strings.ToLower(word), "www.") {
+			continue
+		}
+		links++
+		link, err := url.Parse(word)
+		if err == nil && link.Host != "" {
+			domains[strings.ToLower(link.Host)]++
+		}
+	}
+	if links > 1 {
+		score += 0.3 * float64(links-1)
+	}
+	for _, count := range domains {
+		if count > 1 {
+			score += 0.5 * float64(count-1)
+		}
+	}
+
+	for _, phrase := range scamPhrases {
+		if strings.Contains(lower, phrase) {
+			score += 0.4
+		}
+	}
+
+	var symbols, characters int
+	for _, r := range description {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		characters++
+		if unicode.Is(unicode.So, r) {
+			symbols++
+		}
+	}
+	if characters >= 10 && float64(symbols)/float64(characters) > 0.3 {
+		score += 0.5
+	}
+	return score
+}
+
+func isSpam(description string) bool {
+	return config.spamHoldThreshold > 0 && spamScore(description) >= config.spamHoldThreshold
+}
+
+func listHeldVideos(ctx *fiber.Ctx) error {
+	filter, findOptions, err := paginate(ctx, bson.D{{"held_for_review", true}})
+	if err != nil {
+		return err
+	}
+	cursor, err := videosCollection.Find(ctx.UserContext(), filter, findOptions)
+	if err != nil {
+		return err
+	}
+	videos := make([]Video, 0)
+	err = cursor.All(ctx.UserContext(), &videos)
+	if err != nil {
+		return err
+	}
+	return sendVideos(ctx, videos)
+}
+
+// Publishes a held video, held videos that really are spam should be taken down instead
+func releaseHeldVideo(ctx *fiber.Ctx) error {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var action ModerationAction
+	err = ctx.BodyParser(&action)
+	if err != nil {
+		return err
+	}
+
+	// Creators may have made the video unlisted or private while it was held
+	isPublic := bson.D{{"$eq", bson.A{bson.D{{"$ifNull", bson.A{"$visibility", visibilityPublic}}}, visibilityPublic}}}
+	result, err := videosCollection.UpdateOne(ctx.UserContext(),
+		bson.D{{"_id", videoId}, {"held_for_review", true}},
+		mongo.Pipeline{{{"$set", bson.D{{"held_for_review", false}, {"public", isPublic}}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fiber.NewError(404, "Video is not held for review")
+	}
+	syncSearchIndex(videoId)
+	return recordAudit(adminId(ctx), "release", "video", ctx.Params("video_id"), action.Reason)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// What a user has done with a video, for rendering its buttons
+type InteractionState struct {
+	Liked   bool `json:"liked"`
+	Watched bool `json:"watched"`
+	Saved   bool `json:"saved"`
+}
+
+type BatchStateRequest struct {
+	UserId   int64   `json:"user_id"`
+	VideoIds []int64 `json:"video_ids"`
+}
+
+type VideoInteractionState struct {
+	VideoId int64 `json:"video_id"`
+	InteractionState
+}
+
+func getInteractionState(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	// The has* checks treat errors as the event existing, which is right for guards but would show it here
+	states, err := interactionStates(ctx, userId, []int64{videoId})
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(states[0].InteractionState)
+}
+
+// Which of the videos the user has an event for in any of the collections, one query per collection
+func videosWithEvents(userId int64, videoIds []int64, collections ...*mongo.Collection) (map[int64]bool, error) {
+	found := make(map[int64]bool)
+	filter := bson.D{{"user_id", userId}, {"video_id", bson.D{{"$in", videoIds}}}}
+	for _, collection := range collections {
+		results, err := collection.Distinct(mctx, "video_id", filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			switch videoId := result.(type) {
+			case int64:
+				found[videoId] = true
+			case int32:
+				found[int64(videoId)] = true
+			}
+		}
+	}
+	return found, nil
+}
+
+func getBatchInteractionState(ctx *fiber.Ctx) error {
+	var request BatchStateRequest
+	err := ctx.BodyParser(&request)
+	if err != nil {
+		return err
+	}
+	if len(request.VideoIds) > maxPageSize {
+		return fiber.NewError(400, "At most "+strconv.Itoa(maxPageSize)+" videos can be looked up at once")
+	}
+
+	if len(request.VideoIds) == 0 {
+		return ctx.JSON([]VideoInteractionState{})
+	}
+
+	// The body names the user, so with auth enabled it has to be the one the token is for
+	if authEnabled() && viewerId(ctx) != request.UserId {
+		return fiber.NewError(403, "Token is for another user")
+	}
+
+	states, err := interactionStates(ctx, request.UserId, request.VideoIds)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(states)
+}
+
+// What the user has done with each of the videos, in their order
+func interactionStates(ctx *fiber.Ctx, userId int64, videoIds []int64) ([]VideoInteractionState, error) {
+	residency, err := userResidency(ctx.UserContext(), userId)
+	if err != nil {
+		return nil, err
+	}
+	likedCollection, likedArchive, watchedCollection, watchedArchive := residentEvents(residency)
+	liked, err := videosWithEvents(userId, videoIds, likedCollection, likedArchive)
+	if err != nil {
+		return nil, err
+	}
+	watched, err := videosWithEvents(userId, videoIds, watchedCollection, watchedArchive)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := videosWithEvents(userId, videoIds, savedVideosCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]VideoInteractionState, len(videoIds))
+	for i, videoId := range videoIds {
+		states[i] = VideoInteractionState{
+			VideoId: videoId,
+			InteractionState: InteractionState{
+				Liked:   liked[videoId],
+				Watched: watched[videoId],
+				Saved:   saved[videoId],
+			},
+		}
+	}
+	return states, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	skynet "github.com/NebulousLabs/go-skynet/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const portalHealthInterval = 30 * time.Second
+
+var errNoPortals = errors.New("no storage portals available")
+
+type storagePortal struct {
+	url     string
+	client  skynet.SkynetClient
+	healthy int32
+}
+
+var storagePortals []*storagePortal
+
+func (portal *storagePortal) isHealthy() bool {
+	return atomic.LoadInt32(&portal.healthy) == 1
+}
+
+func (portal *storagePortal) setHealthy(healthy bool) {
+	var value int32
+	if healthy {
+		value = 1
+	}
+	if atomic.SwapInt32(&portal.healthy, value) != value {
+		log.Printf("Storage portal %s healthy: %t", portal.url, healthy)
+	}
+}
+
+// Portals are tried in the configured order, with the first one being the default portal when none are configured
+func initStorage() {
+	urls := []string{config.skynetPortal}
+	if config.skynetPortals != "" {
+		urls = strings.Split(config.skynetPortals, ",")
+	}
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		client := skynet.NewCustom(url, skynet.Options{})
+		storagePortals = append(storagePortals, &storagePortal{url: client.PortalURL, client: client, healthy: 1})
+	}
+
+	every(portalHealthInterval, func() {
+		for _, portal := range storagePortals {
+			portal.setHealthy(checkPortal(portal))
+		}
+	})
+}
+
+func checkPortal(portal *storagePortal) bool {
+	response, err := httpClient.Get(portal.url)
+	if err != nil {
+		return false
+	}
+	response.Body.Close()
+	return response.StatusCode < http.StatusInternalServerError
+}
+
+// Healthy portals first, falling back to the unhealthy ones in case they recovered
+func portalsByHealth() []*storagePortal {
+	ordered := make([]*storagePortal, 0, len(storagePortals))
+	for _, portal := range storagePortals {
+		if portal.isHealthy() {
+			ordered = append(ordered, portal)
+		}
+	}
+	for _, portal := range storagePortals {
+		if !portal.isHealthy() {
+			ordered = append(ordered, portal)
+		}
+	}
+	return ordered
+}
+
+// Stores a video file and returns its storage key, failing over to the next portal on errors.
+// Every attempt gets a span under the context's.
+func storeVideo(ctx context.Context, filename string, file io.ReadSeeker) (string, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	storageUploadSize.observe(ctx, float64(size))
+
+	err = errNoPortals
+	for _, portal := range portalsByHealth() {
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+		var storageKey string
+		spanCtx, span := tracer.Start(ctx, "storage upload", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			attribute.String("storage.portal", portal.url),
+			attribute.Int64("storage.size_bytes", size),
+		))
+		start := time.Now()
+		err = injectFault()
+		if err == nil {
+			storageKey, err = portal.client.Upload(skynet.UploadData{filename: file}, skynet.DefaultUploadOptions)
+		}
+		storageUploadDuration.observeDuration(spanCtx, start, portal.url, statusLabel(err != nil))
+		finishSpan(span, err)
+		if err == nil {
+			portal.setHealthy(true)
+			return storageKey, nil
+		}
+		log.Printf("Upload to %s failed: %s", portal.url, err)
+		portal.setHealthy(false)
+	}
+	return "", err
+}
+
+// Reads back a stored video, a failed download alone doesn't mark a portal unhealthy as the file may just be missing
+func readStoredVideo(storageKey string) (io.ReadCloser, error) {
+	if strings.HasPrefix(storageKey, directUploadPrefix) {
+		return readDirectUpload(storageKey)
+	}
+	err := errNoPortals
+	for _, portal := range portalsByHealth() {
+		var stored io.ReadCloser
+		err = injectFault()
+		if err == nil {
+			stored, err = portal.client.Download(storageKey, skynet.DefaultDownloadOptions)
+		}
+		if err == nil {
+			return stored, nil
+		}
+	}
+	return nil, err
+}
+
+// Unpins the video from every portal since it's not known which ones pinned it, direct uploads are deleted from the bucket
+func deleteStoredVideo(storageKey string) error {
+	if strings.HasPrefix(storageKey, directUploadPrefix) {
+		return deleteDirectUpload(storageKey)
+	}
+	skylink := strings.TrimPrefix(storageKey, "sia://")
+	var err error
+	for _, portal := range storagePortals {
+		var response *http.Response
+		response, err = httpClient.Post(portal.url+"/skynet/unpin/"+skylink, "application/json", nil)
+		if err != nil {
+			log.Printf("Unpinning from %s failed: %s", portal.url, err)
+			continue
+		}
+		response.Body.Close()
+		if response.StatusCode >= 300 && response.StatusCode != http.StatusNotFound {
+			err = fmt.Errorf("portal %s responded with %d", portal.url, response.StatusCode)
+			log.Printf("Unpinning from %s failed: %s", portal.url, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type StorageUsage struct {
+	UserId       int64 `bson:"_id" json:"user_id"`
+	StorageBytes int64 `bson:"storage_bytes" json:"storage_bytes"`
+	Videos       int64 `bson:"-" json:"videos,omitempty"`
+}
+
+func createStorageIndex() {
+	_, err := usersCollection.Indexes().CreateOne(mctx, mongo.IndexModel{
+		Keys:    bson.D{{"storage_bytes", -1}},
+		Options: options.Index().SetPartialFilterExpression(bson.D{{"storage_bytes", bson.D{{"$gt", 0}}}}),
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Adds to the bytes the creator has stored, negative when a video is removed.
+// Videos uploaded before sizes were tracked have no size and don't count.
+func adjustStorageUsage(creatorId int64, bytes int64) error {
+	if bytes == 0 {
+		return nil
+	}
+	_, err := usersCollection.UpdateOne(mctx, bson.D{{"_id", creatorId}}, bson.D{{"$inc", bson.D{{"storage_bytes", bytes}}}})
+	return err
+}
+
+func getStorageUsage(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	usage := StorageUsage{UserId: userId}
+	err = usersCollection.FindOne(ctx.UserContext(), bson.D{{"_id", userId}}, options.FindOne().SetProjection(bson.D{{"storage_bytes", 1}})).Decode(&usage)
+	if err != nil {
+		return err
+	}
+	usage.Videos, err = videosCollection.CountDocuments(ctx.UserContext(), bson.D{{"creator_id", userId}})
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(usage)
+}
+
+// The creators storing the most, ?limit= up to 500
+func getTopStorageUsers(ctx *fiber.Ctx) error {
+	limit, err := strconv.ParseInt(ctx.Query("limit", "50"), 10, 64)
+	if err != nil {
+		return err
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 500
+	}
+	cursor, err := usersCollection.Find(ctx.UserContext(), bson.D{{"storage_bytes", bson.D{{"$gt", 0}}}}, options.Find().
+		SetSort(bson.D{{"storage_bytes", -1}}).
+		SetLimit(limit).
+		SetProjection(bson.D{{"storage_bytes", 1}}))
+	if err != nil {
+		return err
+	}
+	usages := make([]StorageUsage, 0)
+	err = cursor.All(ctx.UserContext(), &usages)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(usages)
+}
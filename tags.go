@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Hashtag pages page by recency or likes
+func createTagIndex() {
+	_, err := videosCollection.Indexes().CreateMany(mctx, []mongo.IndexModel{
+		{Keys: bson.D{{"tags", 1}, {"_id", -1}}},
+		{Keys: bson.D{{"tags", 1}, {"likes", -1}, {"_id", -1}}},
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func getTagVideos(ctx *fiber.Ctx) error {
+	// Tags are stored the same way extractTags reads them from descriptions
+	tag := strings.ToLower(strings.Trim(ctx.Params("tag"), "#"))
+	if tag == "" {
+		return fiber.NewError(400, "Missing tag")
+	}
+	allowed, err := withoutBannedTags([]string{tag})
+	if err != nil {
+		return err
+	}
+	if len(allowed) == 0 {
+		return ctx.JSON([]Video{})
+	}
+
+	blocks, err := viewerBlockFilter(ctx)
+	if err != nil {
+		return err
+	}
+	filter := append(bson.D{{"tags", tag}, {"public", true}, {"taken_down", bson.D{{"$ne", true}}}}, blocks...)
+	filter = append(filter, regionFilter(viewerCountry(ctx))...)
+	filter, findOptions, err := paginateVideos(ctx, filter)
+	if err != nil {
+		return err
+	}
+	cursor, err := videosCollection.Find(ctx.UserContext(), filter, findOptions)
+	if err != nil {
+		return err
+	}
+	videos := make([]Video, 0)
+	err = cursor.All(ctx.UserContext(), &videos)
+	if err != nil {
+		return err
+	}
+	return sendVideos(ctx, videos)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "interactions"
+
+// Until tracing is set up this is the no-op tracer, so spans can be started either way
+var tracer = otel.Tracer(serviceName)
+
+var tracerProvider *sdktrace.TracerProvider
+
+func tracingEnabled() bool {
+	return config.otlpEndpoint != ""
+}
+
+// Exports spans in batches to the collector's /v1/traces over otlp/http
+func initTracing() {
+	if !tracingEnabled() {
+		return
+	}
+	endpoint, err := url.Parse(config.otlpEndpoint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exporterOptions := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(endpoint.Path, "/") + "/v1/traces"),
+	}
+	if endpoint.Scheme == "http" {
+		exporterOptions = append(exporterOptions, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(mctx, exporterOptions...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// Exports the spans that are still buffered
+func flushSpans() {
+	if tracerProvider == nil {
+		return
+	}
+	flushCtx, cancel := context.WithTimeout(mctx, 5*time.Second)
+	defer cancel()
+	err := tracerProvider.Shutdown(flushCtx)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Spans every mongo command under the span of the context it was run with. Commands hold user data such as
+// ip hashes, so they aren't recorded.
+func mongoTracingMonitor() *event.CommandMonitor {
+	return otelmongo.NewMonitor(otelmongo.WithCommandAttributeDisabled(true))
+}
+
+// Lets the propagator read and write fiber's request headers
+type requestHeaders struct {
+	ctx *fiber.Ctx
+}
+
+func (headers requestHeaders) Get(key string) string {
+	return headers.ctx.Get(key)
+}
+
+func (headers requestHeaders) Set(key string, value string) {
+	headers.ctx.Request().Header.Set(key, value)
+}
+
+func (headers requestHeaders) Keys() []string {
+	keys := make([]string, 0)
+	headers.ctx.Request().Header.VisitAll(func(key []byte, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// Continues the caller's trace when the request has a traceparent header. The span is put in the request's
+// context, so everything run with ctx.UserContext() is traced under it.
+func traceRequests(ctx *fiber.Ctx) error {
+	if !tracingEnabled() {
+		return ctx.Next()
+	}
+	parent := otel.GetTextMapPropagator().Extract(ctx.UserContext(), requestHeaders{ctx})
+	spanCtx, span := tracer.Start(parent, ctx.Method(), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	ctx.SetUserContext(spanCtx)
+
+	err := ctx.Next()
+	// Errors are only rendered further out, their status is what they will be rendered with
+	status := ctx.Response().StatusCode()
+	if err != nil {
+		status, _, _ = classifyError(err)
+	}
+	span.SetName(ctx.Method() + " " + ctx.Route().Path)
+	span.SetAttributes(
+		semconv.HTTPMethodKey.String(ctx.Method()),
+		semconv.HTTPRouteKey.String(ctx.Route().Path),
+		semconv.HTTPTargetKey.String(ctx.OriginalURL()),
+		semconv.HTTPStatusCodeKey.Int(status),
+	)
+	if requestId, ok := ctx.Locals("requestid").(string); ok {
+		span.SetAttributes(attribute.String("request_id", requestId))
+	}
+	if status >= 500 {
+		span.SetStatus(codes.Error, "status "+strconv.Itoa(status))
+	}
+	return err
+}
+
+// Marks a span as failed when the work it covers did
+func finishSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Translation struct {
+	// Hash of the source text and target language, so edited text is translated again
+	Id       string    `bson:"_id" json:"-"`
+	Language string    `bson:"language" json:"language"`
+	Text     string    `bson:"text" json:"text"`
+	Time     time.Time `bson:"time" json:"-"`
+}
+
+func translationKey(text string, language string) string {
+	sum := sha256.Sum256([]byte(language + ":" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// Calls a LibreTranslate compatible backend
+func requestTranslation(text string, language string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  "auto",
+		"target":  language,
+		"format":  "text",
+		"api_key": config.translationApiKey,
+	})
+	if err != nil {
+		return "", err
+	}
+	response, err := httpClient.Post(config.translationUrl+"/translate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return "", fmt.Errorf("translation backend responded with %d", response.StatusCode)
+	}
+	var result struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return "", err
+	}
+	return result.TranslatedText, nil
+}
+
+func translate(text string, language string) (Translation, error) {
+	key := translationKey(text, language)
+	var translation Translation
+	err := translationsCollection.FindOne(mctx, bson.D{{"_id", key}}).Decode(&translation)
+	if err == nil {
+		return translation, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return Translation{}, err
+	}
+
+	translated, err := requestTranslation(text, language)
+	if err != nil {
+		return Translation{}, err
+	}
+	translation = Translation{Id: key, Language: language, Text: translated, Time: time.Now()}
+	_, err = translationsCollection.InsertOne(mctx, translation)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return Translation{}, err
+	}
+	return translation, nil
+}
+
+// Fails when translations are unavailable or ?to= isn't a language code
+func translationTarget(ctx *fiber.Ctx) (string, error) {
+	if config.translationUrl == "" {
+		return "", fiber.NewError(501, "Translation is not configured")
+	}
+	language := strings.ToLower(ctx.Query("to"))
+	if len(language) != 2 {
+		return "", fiber.NewError(400, "Target language must be an ISO 639-1 code")
+	}
+	return language, nil
+}
+
+func translateDescription(ctx *fiber.Ctx) error {
+	language, err := translationTarget(ctx)
+	if err != nil {
+		return err
+	}
+	video, ok, err := getViewableVideo(ctx, viewerId(ctx))
+	if !ok {
+		return err
+	}
+
+	translation, err := translate(video.Description, language)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(translation)
+}
+
+func translateComment(ctx *fiber.Ctx) error {
+	language, err := translationTarget(ctx)
+	if err != nil {
+		return err
+	}
+	_, ok, err := getViewableVideo(ctx, viewerId(ctx))
+	if !ok {
+		return err
+	}
+	comment, ok, err := getComment(ctx)
+	if !ok {
+		return err
+	}
+
+	translation, err := translate(comment.Text, language)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(translation)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Videos only become eligible for trending once the warm-up after upload has passed, so bursts of
+// bot engagement right at publish time can be discounted before they count
+func trendingEligibleAt(uploaded time.Time) time.Time {
+	return uploaded.Add(config.trendingWarmup)
+}
+
+// Videos uploaded before the warm-up existed have no eligibility time, they get the one they'd have had
+// from the upload time in their snowflake id
+func backfillTrendingEligibility() {
+	uploadedMs := bson.D{{"$add", bson.A{
+		bson.D{{"$toLong", bson.D{{"$floor", bson.D{{"$divide", bson.A{"$_id", int64(1) << (snowflake.NodeBits + snowflake.StepBits)}}}}}}},
+		snowflake.Epoch,
+	}}}
+	eligibleAt := bson.D{{"$toDate", bson.D{{"$add", bson.A{uploadedMs, config.trendingWarmup.Milliseconds()}}}}}
+	result, err := videosCollection.UpdateMany(mctx,
+		bson.D{{"trending_eligible_at", bson.D{{"$exists", false}}}},
+		mongo.Pipeline{{{"$set", bson.D{{"trending_eligible_at", eligibleAt}}}}},
+	)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Backfilled the trending eligibility of %d videos", result.ModifiedCount)
+	}
+}
+
+func getTrending(ctx *fiber.Ctx) error {
+	limit, err := pageLimit(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	filter := bson.D{
+		{"trending_eligible_at", bson.D{{"$lte", now}, {"$gte", now.Add(-config.trendingMaxAge)}}},
+		{"public", true},
+		{"taken_down", bson.D{{"$ne", true}}},
+		{"age_restricted", bson.D{{"$ne", true}}},
+	}
+	filter = append(filter, regionFilter(viewerCountry(ctx))...)
+	blocks, err := viewerBlockFilter(ctx)
+	if err != nil {
+		return err
+	}
+	filter = append(filter, blocks...)
+
+	cursor, err := videosCollection.Find(ctx.UserContext(), filter, options.Find().SetSort(bson.D{{"engagement_rate", -1}, {"_id", -1}}).SetLimit(limit))
+	if err != nil {
+		return err
+	}
+	videos := make([]Video, 0)
+	err = cursor.All(ctx.UserContext(), &videos)
+	if err != nil {
+		return err
+	}
+	return sendVideos(ctx, videos)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Tags with fewer weighted likes and watches in the window aren't trending, however fast they grow
+const minTrendingTagEvents = 10
+
+type TrendingTag struct {
+	Tag            string  `bson:"_id" json:"tag"`
+	Events         float64 `bson:"current" json:"events"`
+	PreviousEvents float64 `bson:"previous" json:"previous_events"`
+	// Events in the window over events in the window before it
+	Growth float64 `bson:"growth" json:"growth"`
+}
+
+var (
+	trendingTags     = make([]TrendingTag, 0)
+	trendingTagsLock sync.RWMutex
+)
+
+func startTrendingTags() {
+	go refreshTrendingTags()
+	every(config.trendingTagsInterval, refreshTrendingTags)
+}
+
+func refreshTrendingTags() {
+	tags, err := computeTrendingTags(time.Now())
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	trendingTagsLock.Lock()
+	trendingTags = tags
+	trendingTagsLock.Unlock()
+}
+
+// Compares likes and watches per tag in the last window with the window before it
+func computeTrendingTags(now time.Time) ([]TrendingTag, error) {
+	boundary := now.Add(-config.trendingTagsWindow)
+	since := boundary.Add(-config.trendingTagsWindow)
+	recent := bson.D{{"$match", bson.D{{"time", bson.D{{"$gte", since}}}}}}
+	recentWatches := bson.D{{"$match", bson.D{{"time", bson.D{{"$gte", since}}}, countedWatchFilter()}}}
+	inWindow := bson.D{{"$gte", bson.A{"$time", boundary}}}
+	weight := watchWeightExpression()
+
+	pipeline := mongo.Pipeline{
+		recent,
+		{{"$unionWith", bson.D{{"coll", likedVideosArchiveCollection.Name()}, {"pipeline", mongo.Pipeline{recent}}}}},
+		{{"$unionWith", bson.D{{"coll", watchedVideosCollection.Name()}, {"pipeline", mongo.Pipeline{recentWatches}}}}},
+		{{"$unionWith", bson.D{{"coll", watchedVideosArchiveCollection.Name()}, {"pipeline", mongo.Pipeline{recentWatches}}}}},
+		// Per video first so every video is only looked up once
+		{{"$group", bson.D{
+			{"_id", "$video_id"},
+			{"current", bson.D{{"$sum", bson.D{{"$cond", bson.A{inWindow, weight, 0}}}}}},
+			{"previous", bson.D{{"$sum", bson.D{{"$cond", bson.A{inWindow, 0, weight}}}}}},
+		}}},
+		{{"$lookup", bson.D{
+			{"from", videosCollection.Name()},
+			{"localField", "_id"},
+			{"foreignField", "_id"},
+			{"as", "video"},
+		}}},
+		{{"$unwind", "$video"}},
+		{{"$match", bson.D{{"video.public", true}, {"video.taken_down", bson.D{{"$ne", true}}}}}},
+		{{"$unwind", "$video.tags"}},
+		{{"$group", bson.D{
+			{"_id", "$video.tags"},
+			{"current", bson.D{{"$sum", "$current"}}},
+			{"previous", bson.D{{"$sum", "$previous"}}},
+		}}},
+		{{"$match", bson.D{{"current", bson.D{{"$gte", minTrendingTagEvents}}}}}},
+		{{"$addFields", bson.D{{"growth", bson.D{{"$divide", bson.A{"$current", bson.D{{"$add", bson.A{"$previous", 1}}}}}}}}}},
+		{{"$sort", bson.D{{"growth", -1}, {"current", -1}}}},
+		{{"$limit", maxPageSize}},
+	}
+	cursor, err := likedVideosCollection.Aggregate(mctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]TrendingTag, 0)
+	err = cursor.All(mctx, &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Tag
+	}
+	allowed, err := withoutBannedTags(names)
+	if err != nil {
+		return nil, err
+	}
+	allowedSet := make(map[string]bool)
+	for _, name := range allowed {
+		allowedSet[name] = true
+	}
+	trending := make([]TrendingTag, 0, len(tags))
+	for _, tag := range tags {
+		if allowedSet[tag.Tag] {
+			trending = append(trending, tag)
+		}
+	}
+	return trending, nil
+}
+
+func getTrendingTags(ctx *fiber.Ctx) error {
+	limit, err := pageLimit(ctx)
+	if err != nil {
+		return err
+	}
+	trendingTagsLock.RLock()
+	tags := trendingTags
+	trendingTagsLock.RUnlock()
+	if int64(len(tags)) > limit {
+		tags = tags[:limit]
+	}
+	return ctx.JSON(tags)
+}
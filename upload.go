@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errDescriptionTooLong = errors.New("description is too long")
+	errNotAVideo          = errors.New("file is not a video")
+)
+
+// Errors caused by what the user uploaded rather than by the service
+func isUploadError(err error) bool {
+	switch err {
+	case errDescriptionTooLong, errNotAVideo, errChecksumMismatch, errInvalidSourceVideo, errInvalidSound, errInvalidLocation:
+		return true
+	}
+	var violation *PolicyViolation
+	return errors.As(err, &violation)
+}
+
+// Tags are the hashtags in the description
+func extractTags(description string) []string {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, word := range strings.Fields(description) {
+		if !strings.HasPrefix(word, "#") {
+			continue
+		}
+		tag := strings.ToLower(strings.Trim(word, "#.,!?"))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func validateUpload(ctx *fiber.Ctx, userId int64, upload VideoUpload) error {
+	_, err := locationFromUpload(upload)
+	if err != nil {
+		return err
+	}
+	return checkUploadPolicies(ctx, userId, upload)
+}
+
+func isVideoContent(header []byte) bool {
+	return strings.HasPrefix(http.DetectContentType(header), "video/")
+}
+
+// Checks the file contents look like a video, leaving the file rewound
+func validateVideoFile(file *os.File) error {
+	header := make([]byte, 512)
+	n, err := file.Read(header)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if !isVideoContent(header[:n]) {
+		return errNotAVideo
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	return err
+}
+
+// Stores an uploaded file and creates its metadata, the upload has to have been validated already
+func processUpload(ctx context.Context, userId int64, upload VideoUpload, file *os.File) (Video, error) {
+	err := validateVideoFile(file)
+	if err != nil {
+		return Video{}, err
+	}
+	err = verifyChecksum(file, upload.Sha256)
+	if err != nil {
+		return Video{}, err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return Video{}, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return Video{}, err
+	}
+
+	id := idNode.Generate().Int64()
+	storageKey, err := storeVideo(ctx, strconv.FormatInt(id, 10), file)
+	if err != nil {
+		return Video{}, err
+	}
+	err = verifyStoredChecksum(storageKey, upload.Sha256)
+	if err != nil {
+		return Video{}, err
+	}
+	return createVideo(id, userId, upload, storageKey, info.Size())
+}
+
+// Creates the metadata for a video that has already been stored
+func createVideo(id int64, userId int64, upload VideoUpload, storageKey string, size int64) (Video, error) {
+	location, err := locationFromUpload(upload)
+	if err != nil {
+		return Video{}, err
+	}
+
+	video := Video{
+		ContentWarnings: upload.ContentWarnings,
+		CoAuthors:       coAuthorsFromUpload(upload),
+		SourceVideoId:   upload.SourceVideoId,
+		RemixType:       upload.RemixType,
+		SoundId:         upload.SoundId,
+		Location:        location,
+		PlaceId:         upload.PlaceId,
+	}
+	video.Id = id
+	video.Description = upload.Description
+	video.Series = upload.Series
+	video.Public = true
+	video.Visibility = visibilityPublic
+	video.CreatorId = userId
+	video.Tags = extractTags(upload.Description)
+	video.StorageKey = storageKey
+	video.SizeBytes = size
+	return uploadVideo(video)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	policyMinAccountAge        = "min_account_age"
+	policyMaxDuration          = "max_duration"
+	policyRequiredTags         = "required_tags"
+	policyRegion               = "region"
+	policyMaxDescriptionLength = "max_description_length"
+)
+
+// Used to create the first policy, before any are configured
+const defaultMaxDescriptionLength = 255
+
+// A rule uploads have to pass, only the fields of its type are used
+type UploadPolicy struct {
+	Name    string `bson:"_id" json:"name"`
+	Type    string `bson:"type" json:"type"`
+	Enabled bool   `bson:"enabled" json:"enabled"`
+	// Shown to the uploader instead of the default message when set
+	Message string `bson:"message,omitempty" json:"message,omitempty"`
+
+	MinAccountAgeHours   int64 `bson:"min_account_age_hours,omitempty" json:"min_account_age_hours,omitempty"`
+	MaxDurationSeconds   int64 `bson:"max_duration_seconds,omitempty" json:"max_duration_seconds,omitempty"`
+	MaxDescriptionLength int64 `bson:"max_description_length,omitempty" json:"max_description_length,omitempty"`
+
+	// Uploads to the series need all of the tags
+	Series       string   `bson:"series,omitempty" json:"series,omitempty"`
+	RequiredTags []string `bson:"required_tags,omitempty" json:"required_tags,omitempty"`
+
+	// Countries of the uploader, when allowed ones are set uploads from unknown countries are refused
+	AllowedCountries []string `bson:"allowed_countries,omitempty" json:"allowed_countries,omitempty"`
+	BlockedCountries []string `bson:"blocked_countries,omitempty" json:"blocked_countries,omitempty"`
+
+	Reason    string    `bson:"reason" json:"reason"`
+	UpdatedBy int64     `bson:"updated_by" json:"updated_by"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Everything about an upload the policies look at
+type uploadAttempt struct {
+	user    User
+	country string
+	upload  VideoUpload
+	tags    []string
+}
+
+// An upload refused by a policy, the message is safe to show to the uploader
+type PolicyViolation struct {
+	Policy  string
+	Message string
+}
+
+func (violation *PolicyViolation) Error() string {
+	return violation.Message
+}
+
+var (
+	uploadPolicies     []UploadPolicy
+	uploadPoliciesLock sync.RWMutex
+)
+
+// Loads the policies now and again every interval, so policies changed through another instance are picked up.
+// The description length limit that used to be built in is created as the first policy.
+func startUploadPolicies() {
+	count, err := uploadPoliciesCollection.CountDocuments(mctx, bson.D{})
+	if err != nil {
+		log.Print(err)
+	}
+	if err == nil && count == 0 {
+		_, err = uploadPoliciesCollection.InsertOne(mctx, UploadPolicy{
+			Name:                 "description_length",
+			Type:                 policyMaxDescriptionLength,
+			Enabled:              true,
+			MaxDescriptionLength: defaultMaxDescriptionLength,
+			UpdatedAt:            time.Now(),
+		})
+		if err != nil {
+			log.Print(err)
+		}
+	}
+
+	err = loadUploadPolicies()
+	if err != nil {
+		log.Print(err)
+	}
+	every(config.uploadPolicyReloadInterval, func() {
+		err := loadUploadPolicies()
+		if err != nil {
+			log.Print(err)
+		}
+	})
+}
+
+func loadUploadPolicies() error {
+	cursor, err := uploadPoliciesCollection.Find(mctx, bson.D{{"enabled", true}}, options.Find().SetSort(bson.D{{"_id", 1}}))
+	if err != nil {
+		return err
+	}
+	loaded := make([]UploadPolicy, 0)
+	err = cursor.All(mctx, &loaded)
+	if err != nil {
+		return err
+	}
+	uploadPoliciesLock.Lock()
+	uploadPolicies = loaded
+	uploadPoliciesLock.Unlock()
+	return nil
+}
+
+func enabledUploadPolicies() []UploadPolicy {
+	uploadPoliciesLock.RLock()
+	defer uploadPoliciesLock.RUnlock()
+	return uploadPolicies
+}
+
+// Returns why the policy refuses the upload, or an empty string
+func (policy UploadPolicy) check(attempt uploadAttempt) string {
+	switch policy.Type {
+	case policyMinAccountAge:
+		// User ids are snowflakes, so they carry the time the account was created
+		created := time.Unix(0, snowflake.ID(attempt.user.Id).Time()*int64(time.Millisecond))
+		if time.Since(created) < time.Duration(policy.MinAccountAgeHours)*time.Hour {
+			return fmt.Sprintf("Accounts have to be at least %d hours old to upload", policy.MinAccountAgeHours)
+		}
+	case policyMaxDuration:
+		if attempt.upload.DurationSeconds <= 0 {
+			return "The video duration is required"
+		}
+		if attempt.upload.DurationSeconds > float64(policy.MaxDurationSeconds) {
+			return fmt.Sprintf("Videos can be at most %d seconds long", policy.MaxDurationSeconds)
+		}
+	case policyRequiredTags:
+		if !strings.EqualFold(attempt.upload.Series, policy.Series) {
+			return ""
+		}
+		for _, required := range policy.RequiredTags {
+			if !containsString(attempt.tags, strings.ToLower(required)) {
+				return "Videos in " + policy.Series + " need the tags #" + strings.Join(policy.RequiredTags, " #")
+			}
+		}
+	case policyRegion:
+		if containsString(policy.BlockedCountries, attempt.country) ||
+			(len(policy.AllowedCountries) > 0 && !containsString(policy.AllowedCountries, attempt.country)) {
+			return "Uploads aren't available in your region"
+		}
+	case policyMaxDescriptionLength:
+		if int64(len(attempt.upload.Description)) > policy.MaxDescriptionLength {
+			return errDescriptionTooLong.Error()
+		}
+	}
+	return ""
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Runs every enabled policy against the upload, stopping at the first one that refuses it
+func checkUploadPolicies(ctx *fiber.Ctx, userId int64, upload VideoUpload) error {
+	policies := enabledUploadPolicies()
+	if len(policies) == 0 {
+		return nil
+	}
+	user, err := getUser(ctx.UserContext(), userId)
+	if err != nil {
+		return err
+	}
+	attempt := uploadAttempt{
+		user:    user,
+		country: viewerCountry(ctx),
+		upload:  upload,
+		tags:    extractTags(upload.Description),
+	}
+	for _, policy := range policies {
+		if message := policy.check(attempt); message != "" {
+			if policy.Message != "" {
+				message = policy.Message
+			}
+			return &PolicyViolation{Policy: policy.Name, Message: message}
+		}
+	}
+	return nil
+}
+
+// Edited descriptions are held to the same limit as uploaded ones
+func checkDescriptionPolicies(description string) error {
+	for _, policy := range enabledUploadPolicies() {
+		if policy.Type != policyMaxDescriptionLength {
+			continue
+		}
+		if message := policy.check(uploadAttempt{upload: VideoUpload{Description: description}}); message != "" {
+			if policy.Message != "" {
+				message = policy.Message
+			}
+			return &PolicyViolation{Policy: policy.Name, Message: message}
+		}
+	}
+	return nil
+}
+
+// Returns what is wrong with the policy, or an empty string
+func validateUploadPolicy(policy UploadPolicy) string {
+	switch policy.Type {
+	case policyMinAccountAge:
+		if policy.MinAccountAgeHours <= 0 {
+			return "min_account_age_hours has to be positive"
+		}
+	case policyMaxDuration:
+		if policy.MaxDurationSeconds <= 0 {
+			return "max_duration_seconds has to be positive"
+		}
+	case policyRequiredTags:
+		if policy.Series == "" || len(policy.RequiredTags) == 0 {
+			return "series and required_tags are required"
+		}
+	case policyRegion:
+		if len(policy.AllowedCountries) == 0 && len(policy.BlockedCountries) == 0 {
+			return "allowed_countries or blocked_countries is required"
+		}
+	case policyMaxDescriptionLength:
+		if policy.MaxDescriptionLength <= 0 {
+			return "max_description_length has to be positive"
+		}
+	default:
+		return "Unknown policy type " + policy.Type
+	}
+	return ""
+}
+
+func registerUploadPolicyRoutes(admin fiber.Router) {
+	admin.Get("/upload_policies", func(ctx *fiber.Ctx) error {
+		cursor, err := uploadPoliciesCollection.Find(ctx.UserContext(), bson.D{}, options.Find().SetSort(bson.D{{"_id", 1}}))
+		if err != nil {
+			return err
+		}
+		stored := make([]UploadPolicy, 0)
+		err = cursor.All(ctx.UserContext(), &stored)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(stored)
+	})
+	admin.Put("/upload_policies/:name", func(ctx *fiber.Ctx) error {
+		var policy UploadPolicy
+		err := ctx.BodyParser(&policy)
+		if err != nil {
+			return err
+		}
+		if message := validateUploadPolicy(policy); message != "" {
+			return fiber.NewError(400, message)
+		}
+		// Countries are matched against the upper case region header
+		for i, country := range policy.AllowedCountries {
+			policy.AllowedCountries[i] = strings.ToUpper(country)
+		}
+		for i, country := range policy.BlockedCountries {
+			policy.BlockedCountries[i] = strings.ToUpper(country)
+		}
+		policy.Name = ctx.Params("name")
+		policy.UpdatedBy = adminId(ctx)
+		policy.UpdatedAt = time.Now()
+
+		_, err = uploadPoliciesCollection.ReplaceOne(ctx.UserContext(), bson.D{{"_id", policy.Name}}, policy, options.Replace().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+		err = loadUploadPolicies()
+		if err != nil {
+			return err
+		}
+		return recordAudit(adminId(ctx), "upload_policy_update", "upload_policy", policy.Name, policy.Reason)
+	})
+	admin.Delete("/upload_policies/:name", func(ctx *fiber.Ctx) error {
+		var action ModerationAction
+		err := ctx.BodyParser(&action)
+		if err != nil {
+			return err
+		}
+		_, err = uploadPoliciesCollection.DeleteOne(ctx.UserContext(), bson.D{{"_id", ctx.Params("name")}})
+		if err != nil {
+			return err
+		}
+		err = loadUploadPolicies()
+		if err != nil {
+			return err
+		}
+		return recordAudit(adminId(ctx), "upload_policy_delete", "upload_policy", ctx.Params("name"), action.Reason)
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func setVerified(ctx *fiber.Ctx, verified bool) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var action ModerationAction
+	err = ctx.BodyParser(&action)
+	if err != nil {
+		return err
+	}
+
+	_, err = usersCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", userId}}, bson.D{{"$set", bson.D{{"verified", verified}}}})
+	if err != nil {
+		return err
+	}
+
+	auditAction := "unverify"
+	if verified {
+		auditAction = "verify"
+	}
+	return recordAudit(adminId(ctx), auditAction, "user", ctx.Params("user_id"), action.Reason)
+}
+
+// Looks up which of the given users are verified in a single query
+func verifiedUsers(userIds []int64) (map[int64]bool, error) {
+	verified := make(map[int64]bool)
+	if len(userIds) == 0 {
+		return verified, nil
+	}
+	ids, err := usersCollection.Distinct(mctx, "_id", bson.D{{"_id", bson.D{{"$in", userIds}}}, {"verified", true}})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		verified[id.(int64)] = true
+	}
+	return verified, nil
+}
+
+// Responds with the videos, flagging the ones whose creator is verified
+func sendVideos(ctx *fiber.Ctx, videos []Video) error {
+	err := withCreatorVerification(videos)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(videos)
+}
+
+// Responds with the comments, flagging the ones whose author is verified
+func sendComments(ctx *fiber.Ctx, comments []Comment) error {
+	authorIds := make([]int64, len(comments))
+	for i, comment := range comments {
+		authorIds[i] = comment.UserId
+	}
+	verified, err := verifiedUsers(authorIds)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].AuthorVerified = verified[comments[i].UserId]
+	}
+	return ctx.JSON(comments)
+}
+
+func withCreatorVerification(videos []Video) error {
+	creatorIds := make([]int64, len(videos))
+	for i, video := range videos {
+		creatorIds[i] = video.CreatorId
+	}
+	verified, err := verifiedUsers(creatorIds)
+	if err != nil {
+		return err
+	}
+	for i := range videos {
+		videos[i].CreatorVerified = verified[videos[i].CreatorId]
+	}
+	return nil
+}
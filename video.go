@@ -0,0 +1,220 @@
+package main
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type VideoUpdate struct {
+	Description *string `json:"description"`
+	Series      *string `json:"series"`
+}
+
+func getVideoHandler(ctx *fiber.Ctx) error {
+	video, ok, err := getViewableVideo(ctx, viewerId(ctx))
+	if !ok {
+		return err
+	}
+
+	videos := []Video{video}
+	err = withCreatorVerification(videos)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(videos[0])
+}
+
+// Videos the creator made or was credited on, private ones are only listed for the creator themselves
+func getCreatorVideos(ctx *fiber.Ctx) error {
+	creatorId, err := strconv.ParseInt(ctx.Params("creator_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	// The creator filter is an $or, which sorted pagination also needs for its cursor
+	filter := bson.D{{"$and", bson.A{bson.D{creatorFilter(creatorId)}}}, {"taken_down", bson.D{{"$ne", true}}}}
+	if viewerId(ctx) != creatorId {
+		filter = append(filter, bson.E{Key: "public", Value: true})
+	}
+	blocks, err := viewerBlockFilter(ctx)
+	if err != nil {
+		return err
+	}
+	filter = append(filter, blocks...)
+	filter = append(filter, regionFilter(viewerCountry(ctx))...)
+	filter, findOptions, err := paginateVideos(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := videosCollection.Find(ctx.UserContext(), filter, findOptions)
+	if err != nil {
+		return err
+	}
+	videos := make([]Video, 0)
+	err = cursor.All(ctx.UserContext(), &videos)
+	if err != nil {
+		return err
+	}
+	return sendVideos(ctx, videos)
+}
+
+// Removes the video and the interactions with it, ?unpin=true also removes the file from storage
+func deleteVideo(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(404, "Video not found")
+	}
+	if err != nil {
+		return err
+	}
+	if video.CreatorId != userId {
+		return fiber.NewError(403, "Only the creator can delete this video")
+	}
+
+	result, err := videosCollection.DeleteOne(ctx.UserContext(), bson.D{{"_id", videoId}})
+	if err != nil {
+		return err
+	}
+	// Only the request that actually removed the video gives its bytes back
+	if result.DeletedCount > 0 {
+		err = adjustStorageUsage(video.CreatorId, -video.SizeBytes)
+		if err != nil {
+			return err
+		}
+	}
+	removeFromSearchIndex(videoId)
+
+	// Comment likes only know their comment, so they go before the comments do
+	commentIds, err := commentsCollection.Distinct(ctx.UserContext(), "_id", bson.D{{"video_id", videoId}})
+	if err != nil {
+		return err
+	}
+	if len(commentIds) > 0 {
+		_, err = commentLikesCollection.DeleteMany(ctx.UserContext(), bson.D{{"comment_id", bson.D{{"$in", commentIds}}}})
+		if err != nil {
+			return err
+		}
+	}
+
+	events := []*mongo.Collection{
+		dislikedVideosCollection,
+		savedVideosCollection,
+		sharesCollection,
+		commentsCollection,
+		quartileEventsCollection,
+		watchSessionsCollection,
+		playbackPositionsCollection,
+	}
+	for _, residency := range residencies() {
+		liked, likedArchive, watched, watchedArchive := residentEvents(residency)
+		events = append(events, liked, likedArchive, watched, watchedArchive)
+	}
+	for _, collection := range events {
+		_, err = collection.DeleteMany(ctx.UserContext(), bson.D{{"video_id", videoId}})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = viewerSketchesCollection.DeleteOne(ctx.UserContext(), bson.D{{"_id", videoId}})
+	if err != nil {
+		return err
+	}
+	// Playlists, watch later queues and series would otherwise keep pointing at the video
+	for _, lists := range []*mongo.Collection{playlistsCollection, watchLaterCollection, seriesCollection} {
+		_, err = lists.UpdateMany(ctx.UserContext(), bson.D{{"videos", videoId}}, bson.D{{"$pull", bson.D{{"videos", videoId}}}})
+		if err != nil {
+			return err
+		}
+	}
+
+	if ctx.Query("unpin") == "true" {
+		err = deleteStoredVideo(video.StorageKey)
+		if err != nil {
+			log.Printf("Failed to remove video %d from storage: %s", videoId, err)
+		}
+	}
+	return nil
+}
+
+// Tags, keywords and the language all follow the description, so they're extracted again when it changes
+func updateVideo(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var update VideoUpdate
+	err = ctx.BodyParser(&update)
+	if err != nil {
+		return err
+	}
+	if update.Description != nil {
+		err = checkDescriptionPolicies(*update.Description)
+		if err != nil {
+			return fiber.NewError(400, err.Error())
+		}
+	}
+
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(404, "Video not found")
+	}
+	if err != nil {
+		return err
+	}
+	if video.CreatorId != userId {
+		return fiber.NewError(403, "Only the creator can change this video")
+	}
+
+	changes := bson.D{}
+	if update.Series != nil {
+		changes = append(changes, bson.E{Key: "series", Value: *update.Series})
+	}
+	if update.Description != nil {
+		tags, err := withoutBannedTags(extractTags(*update.Description))
+		if err != nil {
+			return err
+		}
+		language := detectLanguage(*update.Description)
+		keywords, err := withoutBannedTags(extractKeywords(*update.Description, language, tags))
+		if err != nil {
+			return err
+		}
+		changes = append(changes,
+			bson.E{Key: "description", Value: *update.Description},
+			bson.E{Key: "tags", Value: tags},
+			bson.E{Key: "keywords", Value: keywords},
+			bson.E{Key: "language", Value: language},
+		)
+		// Editing spam into a published description holds it again
+		if shouldHoldDescription(*update.Description, language) {
+			changes = append(changes, bson.E{Key: "held_for_review", Value: true}, bson.E{Key: "public", Value: false})
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	_, err = videosCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", videoId}}, bson.D{{"$set", changes}})
+	if err != nil {
+		return err
+	}
+	syncSearchIndex(videoId)
+	return nil
+}
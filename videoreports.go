@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	reportReceived = "received"
+	// Looked at by a moderator, no action was needed
+	reportReviewed = "reviewed"
+	reportActioned = "actioned"
+)
+
+// A user's report of a video, moderators work through received reports oldest first
+type VideoReport struct {
+	Id         int64      `bson:"_id" json:"id"`
+	VideoId    int64      `bson:"video_id" json:"video_id"`
+	UserId     int64      `bson:"user_id" json:"user_id"`
+	Reason     string     `bson:"reason" json:"reason"`
+	Status     string     `bson:"status" json:"status"`
+	Time       time.Time  `bson:"time" json:"time"`
+	ReviewedAt *time.Time `bson:"reviewed_at,omitempty" json:"reviewed_at,omitempty"`
+}
+
+type ReportRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ReportReview struct {
+	// dismiss or takedown
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+func registerVideoReportRoutes() {
+	app.Post("/report/:video_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		var request ReportRequest
+		err = ctx.BodyParser(&request)
+		if err != nil {
+			return err
+		}
+
+		_, ok, err := getViewableVideo(ctx, userId)
+		if !ok {
+			return err
+		}
+		// Reporting again returns the open report instead of queueing another
+		var report VideoReport
+		err = videoReportsCollection.FindOne(ctx.UserContext(), bson.D{{"video_id", videoId}, {"user_id", userId}, {"status", reportReceived}}).Decode(&report)
+		if err == nil {
+			return ctx.JSON(report)
+		}
+		if err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		report = VideoReport{
+			Id:      idNode.Generate().Int64(),
+			VideoId: videoId,
+			UserId:  userId,
+			Reason:  request.Reason,
+			Status:  reportReceived,
+			Time:    time.Now(),
+		}
+		_, err = videoReportsCollection.InsertOne(ctx.UserContext(), report)
+		if err != nil {
+			return err
+		}
+		return ctx.Status(201).JSON(report)
+	})
+	// Only the reporter can see their report
+	app.Get("/report/:report_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		reportId, err := strconv.ParseInt(ctx.Params("report_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		var report VideoReport
+		err = videoReportsCollection.FindOne(ctx.UserContext(), bson.D{{"_id", reportId}, {"user_id", userId}}).Decode(&report)
+		if err == mongo.ErrNoDocuments {
+			return fiber.NewError(404, "Report not found")
+		}
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(report)
+	})
+}
+
+// The moderation queue, received reports by default
+func listReports(ctx *fiber.Ctx) error {
+	limit, err := pageLimit(ctx)
+	if err != nil {
+		return err
+	}
+	filter := bson.D{{"status", ctx.Query("status", reportReceived)}}
+	cursor, err := videoReportsCollection.Find(ctx.UserContext(), filter, options.Find().SetSort(bson.D{{"_id", 1}}).SetLimit(limit))
+	if err != nil {
+		return err
+	}
+	reports := make([]VideoReport, 0)
+	err = cursor.All(ctx.UserContext(), &reports)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(reports)
+}
+
+// Marks every open report of a video that was taken down as actioned
+func resolveReports(videoId int64) error {
+	filter := bson.D{{"video_id", videoId}, {"status", reportReceived}}
+	update := bson.D{{"$set", bson.D{{"status", reportActioned}, {"reviewed_at", time.Now()}}}}
+	_, err := videoReportsCollection.UpdateMany(mctx, filter, update)
+	return err
+}
+
+// Taking the video down resolves every open report of it
+func reviewReport(ctx *fiber.Ctx) error {
+	reportId, err := strconv.ParseInt(ctx.Params("report_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var review ReportReview
+	err = ctx.BodyParser(&review)
+	if err != nil {
+		return err
+	}
+	var report VideoReport
+	err = videoReportsCollection.FindOne(ctx.UserContext(), bson.D{{"_id", reportId}}).Decode(&report)
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(404, "Report not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	switch review.Action {
+	case "dismiss":
+		_, err = videoReportsCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", reportId}}, bson.D{{"$set", bson.D{{"status", reportReviewed}, {"reviewed_at", time.Now()}}}})
+		if err != nil {
+			return err
+		}
+		return recordAudit(adminId(ctx), "report_dismiss", "report", ctx.Params("report_id"), review.Reason)
+	case "takedown":
+		return takeDownVideo(ctx, report.VideoId, review.Reason)
+	}
+	return fiber.NewError(400, "Action must be dismiss or takedown")
+}
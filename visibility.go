@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Unlisted videos can be reached by anyone with the id but don't show up in listings,
+// private ones are only for the creator
+const (
+	visibilityPublic   = "public"
+	visibilityUnlisted = "unlisted"
+	visibilityPrivate  = "private"
+)
+
+type VisibilityUpdate struct {
+	Visibility string `json:"visibility"`
+}
+
+// Videos from before visibility was added have none and are public. Held videos wait for moderation, so like private
+// ones only their creator can see them.
+func canView(video Video, userId int64) bool {
+	return (video.Visibility != visibilityPrivate && !video.HeldForReview) || video.CreatorId == userId
+}
+
+// The :video_id video, when the viewer may see it. Returns ok=false with the error to respond with otherwise.
+func getViewableVideo(ctx *fiber.Ctx, viewer int64) (Video, bool, error) {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return Video{}, false, err
+	}
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err == mongo.ErrNoDocuments {
+		return Video{}, false, fiber.NewError(404, "Video not found")
+	}
+	if err != nil {
+		return Video{}, false, err
+	}
+	if video.TakenDown {
+		return Video{}, false, fiber.NewError(410, "Video has been taken down")
+	}
+	if !availableIn(video, viewerCountry(ctx)) {
+		return Video{}, false, fiber.NewError(451, "Video is not available in your region")
+	}
+	if !canView(video, viewer) {
+		return Video{}, false, fiber.NewError(403, "Video is private")
+	}
+	return video, true, nil
+}
+
+// Lists such as playlists can hold videos that went private or were taken down after they were added, the viewer
+// only gets the details of the ones they could open
+func viewableVideos(ctx *fiber.Ctx, viewer int64, videos []Video) []Video {
+	country := viewerCountry(ctx)
+	viewable := make([]Video, 0, len(videos))
+	for _, video := range videos {
+		if !video.TakenDown && availableIn(video, country) && canView(video, viewer) {
+			viewable = append(viewable, video)
+		}
+	}
+	return viewable
+}
+
+// Viewers of endpoints without a user in the path pass themselves as a query parameter, 0 when missing
+func queryUserId(ctx *fiber.Ctx, name string) int64 {
+	userId, err := strconv.ParseInt(ctx.Query(name), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return userId
+}
+
+func setVisibility(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var update VisibilityUpdate
+	err = ctx.BodyParser(&update)
+	if err != nil {
+		return err
+	}
+	if update.Visibility != visibilityPublic && update.Visibility != visibilityUnlisted && update.Visibility != visibilityPrivate {
+		return fiber.NewError(400, "Visibility must be public, unlisted or private")
+	}
+
+	video, err := getVideo(ctx.UserContext(), videoId)
+	if err != nil {
+		return err
+	}
+	if video.CreatorId != userId {
+		return fiber.NewError(403, "Only the creator can change this video")
+	}
+	if video.HeldForReview && update.Visibility == visibilityPublic {
+		return fiber.NewError(409, "Video is held for review")
+	}
+
+	// Listings only include public videos, so public keeps following the visibility
+	changes := bson.D{{"visibility", update.Visibility}, {"public", update.Visibility == visibilityPublic}}
+	_, err = videosCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", videoId}}, bson.D{{"$set", changes}})
+	if err != nil {
+		return err
+	}
+	syncSearchIndex(videoId)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var contentWarningLabels = map[string]bool{
+	"flashing_lights":  true,
+	"sensitive_topics": true,
+	"violence":         true,
+	"strong_language":  true,
+	"medical":          true,
+}
+
+type ContentWarningsUpdate struct {
+	ContentWarnings []string `json:"content_warnings"`
+	Reason          string   `json:"reason"`
+}
+
+func validContentWarnings(labels []string) []string {
+	valid := make([]string, 0, len(labels))
+	seen := make(map[string]bool)
+	for _, label := range labels {
+		if contentWarningLabels[label] && !seen[label] {
+			seen[label] = true
+			valid = append(valid, label)
+		}
+	}
+	return valid
+}
+
+// Filter hiding videos with labels the user has opted out of
+func contentWarningFilter(user User) bson.D {
+	if len(user.HiddenContentWarnings) == 0 {
+		return bson.D{}
+	}
+	return bson.D{{"content_warnings", bson.D{{"$nin", user.HiddenContentWarnings}}}}
+}
+
+func adminSetContentWarnings(ctx *fiber.Ctx) error {
+	videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var update ContentWarningsUpdate
+	err = ctx.BodyParser(&update)
+	if err != nil {
+		return err
+	}
+
+	labels := validContentWarnings(update.ContentWarnings)
+	_, err = videosCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", videoId}}, bson.D{{"$set", bson.D{{"content_warnings", labels}}}})
+	if err != nil {
+		return err
+	}
+	return recordAudit(adminId(ctx), "content_warnings", "video", ctx.Params("video_id"), update.Reason)
+}
+
+func setHiddenContentWarnings(ctx *fiber.Ctx) error {
+	userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return err
+	}
+	var update ContentWarningsUpdate
+	err = ctx.BodyParser(&update)
+	if err != nil {
+		return err
+	}
+
+	labels := validContentWarnings(update.ContentWarnings)
+	_, err = usersCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", userId}}, bson.D{{"$set", bson.D{{"hidden_content_warnings", labels}}}})
+	return err
+}
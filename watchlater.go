@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WatchLaterQueue struct {
+	UserId int64   `bson:"_id" json:"user_id"`
+	Videos []int64 `bson:"videos" json:"videos"`
+}
+
+func getWatchLaterQueue(userId int64) (WatchLaterQueue, error) {
+	var queue WatchLaterQueue
+	err := watchLaterCollection.FindOne(mctx, bson.D{{"_id", userId}}).Decode(&queue)
+	if err == mongo.ErrNoDocuments {
+		return WatchLaterQueue{UserId: userId, Videos: []int64{}}, nil
+	}
+	if err != nil {
+		return WatchLaterQueue{}, err
+	}
+	return queue, nil
+}
+
+func removeFromWatchLater(userId int64, videoId int64) error {
+	_, err := watchLaterCollection.UpdateOne(mctx, bson.D{{"_id", userId}}, bson.D{{"$pull", bson.D{{"videos", videoId}}}})
+	return err
+}
+
+func registerWatchLaterRoutes() {
+	app.Post("/watch_later/:video_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		video, ok, err := getViewableVideo(ctx, userId)
+		if !ok {
+			return err
+		}
+
+		_, err = watchLaterCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", userId}}, bson.D{{"$addToSet", bson.D{{"videos", video.Id}}}}, options.Update().SetUpsert(true))
+		return err
+	})
+	app.Delete("/watch_later/:video_id/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		videoId, err := strconv.ParseInt(ctx.Params("video_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		return removeFromWatchLater(userId, videoId)
+	})
+	app.Put("/watch_later/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		var order WatchLaterQueue
+		err = ctx.BodyParser(&order)
+		if err != nil {
+			return err
+		}
+
+		queue, err := getWatchLaterQueue(userId)
+		if err != nil {
+			return err
+		}
+		if !sameVideos(queue.Videos, order.Videos) {
+			return fiber.NewError(400, "Order must contain exactly the queued videos")
+		}
+
+		_, err = watchLaterCollection.UpdateOne(ctx.UserContext(), bson.D{{"_id", userId}}, bson.D{{"$set", bson.D{{"videos", order.Videos}}}})
+		return err
+	})
+	app.Get("/watch_later/:user_id", func(ctx *fiber.Ctx) error {
+		userId, err := strconv.ParseInt(ctx.Params("user_id"), 10, 64)
+		if err != nil {
+			return err
+		}
+		queue, err := getWatchLaterQueue(userId)
+		if err != nil {
+			return err
+		}
+		videos, err := getVideosInOrder(ctx.UserContext(), queue.Videos)
+		if err != nil {
+			return err
+		}
+		return sendVideos(ctx, viewableVideos(ctx, userId, videos))
+	})
+}
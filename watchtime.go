@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Optional details about how much of the video was watched
+type WatchStats struct {
+	WatchDurationMs   int64    `json:"watch_duration_ms"`
+	CompletionPercent *float64 `json:"completion_percent"`
+}
+
+func parseWatchStats(ctx *fiber.Ctx) (WatchStats, error) {
+	var stats WatchStats
+	if len(ctx.Body()) == 0 {
+		return stats, nil
+	}
+	err := ctx.BodyParser(&stats)
+	if err != nil {
+		return stats, err
+	}
+	if stats.WatchDurationMs < 0 {
+		stats.WatchDurationMs = 0
+	}
+	if stats.CompletionPercent != nil {
+		completion := math.Max(0, math.Min(100, *stats.CompletionPercent))
+		stats.CompletionPercent = &completion
+	}
+	return stats, nil
+}
+
+// Watches without a completion can't tell, so they leave the video queued
+func finishedWatching(stats WatchStats) bool {
+	return stats.CompletionPercent != nil && *stats.CompletionPercent >= config.watchLaterCompletion*100
+}
+
+// Watching a quarter of a video is neutral, a full watch adds the full watch weight and skipping
+// right away takes off a third of it. Watches without a completion keep the old flat -1.
+func watchInterestDelta(stats WatchStats) int64 {
+	if stats.CompletionPercent == nil {
+		return -1
+	}
+	return int64(math.Round((*stats.CompletionPercent - 25) / 75 * float64(config.fullWatchInterestWeight)))
+}
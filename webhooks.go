@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+func postWebhook(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	response, err := httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with %d", url, response.StatusCode)
+	}
+	return nil
+}
+
+// Retries with exponential backoff, starting at one second. Shutdown doesn't wait for the backoff, the
+// webhook is given up with errShuttingDown.
+func postWebhookWithRetries(url string, payload interface{}, attempts int64) error {
+	var err error
+	backoff := time.Second
+	for attempt := int64(1); ; attempt++ {
+		err = postWebhook(url, payload)
+		if err == nil || attempt >= attempts {
+			return err
+		}
+		select {
+		case <-stopping:
+			return errShuttingDown
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func notifyIndexer(video Video) {
+	if config.indexingWebhook == "" {
+		return
+	}
+	background(func() {
+		err := postWebhookWithRetries(config.indexingWebhook, video, config.webhookAttempts)
+		if err != nil {
+			log.Printf("Failed to index video %d: %s", video.Id, err)
+		}
+	})
+}